@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/klog/v2"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// configureLogging sets the output format of the logs. The text format is the default format of klog.
+func configureLogging(format string) error {
+	switch format {
+	case logFormatText:
+		return nil
+	case logFormatJSON:
+		klog.SetLogger(zapr.NewLogger(newJSONLogger(zapcore.Lock(os.Stderr))))
+		return nil
+	default:
+		return fmt.Errorf("expected %v or %v, got %q", logFormatText, logFormatJSON, format)
+	}
+}
+
+// newJSONLogger creates a logger that writes one JSON object per line to out.
+// The logger enables every level, because klog already filters the logs by the -v flag.
+func newJSONLogger(out zapcore.WriteSyncer) *zap.Logger {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "ts"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.EncodeLevel = encodeLevel
+
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), out, zap.LevelEnablerFunc(func(zapcore.Level) bool {
+		return true
+	}))
+
+	return zap.New(core)
+}
+
+// encodeLevel encodes the levels of zap. zapr maps the verbosity of the logs to levels below the info level,
+// which are all encoded as info.
+func encodeLevel(level zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	if level < zapcore.InfoLevel {
+		level = zapcore.InfoLevel
+	}
+	zapcore.LowercaseLevelEncoder(level, enc)
+}
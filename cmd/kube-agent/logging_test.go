@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/klog/v2"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var out bytes.Buffer
+	klog.SetLogger(zapr.NewLogger(newJSONLogger(zapcore.AddSync(&out))))
+	defer klog.SetLogger(nil)
+
+	klog.InfoS("Adding or updating TCPServer", "tcpserver", klog.KRef("default", "tcps"), "service", klog.KRef("default", "svc"))
+	klog.ErrorS(errors.New("test failed"), "Error when applying TCPServer NGINX config", "tcpserver", klog.KRef("default", "tcps"))
+
+	expected := []map[string]interface{}{
+		{
+			"level":     "info",
+			"msg":       "Adding or updating TCPServer",
+			"tcpserver": "default/tcps",
+			"service":   "default/svc",
+		},
+		{
+			"level":     "error",
+			"msg":       "Error when applying TCPServer NGINX config",
+			"tcpserver": "default/tcps",
+			"error":     "test failed",
+		},
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("the JSON logger wrote %v lines, expected %v: %v", len(lines), len(expected), out.String())
+	}
+
+	for i, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Errorf("the JSON logger wrote a line that is not JSON: %v: %v", line, err)
+			continue
+		}
+
+		if _, exists := entry["ts"]; !exists {
+			t.Errorf("the JSON logger wrote %v without the ts key", line)
+		}
+		for key, value := range expected[i] {
+			if entry[key] != value {
+				t.Errorf("the JSON logger wrote %v for the key %v in %v, expected %v", entry[key], key, line, value)
+			}
+		}
+	}
+}
@@ -1,18 +1,34 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/golang/glog"
+	"github.com/mohamed-gougam/kube-agent/internal/debug"
+	"github.com/mohamed-gougam/kube-agent/internal/health"
+	"github.com/mohamed-gougam/kube-agent/internal/metrics"
 	"github.com/mohamed-gougam/kube-agent/internal/metrics/collectors"
 	"github.com/mohamed-gougam/kube-agent/internal/nginx"
+	"github.com/mohamed-gougam/kube-agent/internal/tracing"
+	"github.com/nginxinc/nginx-plus-go-client/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	kubeinformers "k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
 
 	"github.com/mohamed-gougam/kube-agent/internal/configuration"
 	"github.com/mohamed-gougam/kube-agent/internal/configuration/version1"
@@ -22,26 +38,61 @@ import (
 )
 
 var (
-	masterURL  string
-	kubeconfig string
+	masterURL             string
+	kubeconfig            string
+	healthPort            int
+	shutdownDelay         time.Duration
+	workerShutdownTimeout time.Duration
+	reloadBatchWindow     time.Duration
+	nginxPlus             bool
+	nginxConfigMaps       string
+	enableSnippets        bool
+	nginxMaxRestarts      int
+	nginxManagerType      string
+
+	enablePrometheusMetrics     bool
+	prometheusMetricsListenPort int
+
+	logFormat string
+
+	enableDebugEndpoints bool
+	debugListenPort      int
+
+	otlpEndpoint string
+	otlpInsecure bool
 )
 
 func main() {
 	flag.Parse()
 
+	if err := configureLogging(logFormat); err != nil {
+		fatal(err, "Invalid value for the log-format argument", "logFormat", logFormat)
+	}
+
+	// without an endpoint, the spans are not recorded
+	shutdownTracing := func() {}
+	if otlpEndpoint != "" {
+		var err error
+		shutdownTracing, err = tracing.Start(otlpEndpoint, otlpInsecure)
+		if err != nil {
+			fatal(err, "Error creating the OTLP exporter of the spans", "endpoint", otlpEndpoint)
+		}
+		klog.InfoS("Exporting spans over OTLP", "endpoint", otlpEndpoint)
+	}
+
 	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
 	if err != nil {
-		glog.Fatalf("Error building kubeconfig: %s", err.Error())
+		fatal(err, "Error building kubeconfig")
 	}
 
 	kubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		glog.Fatalf("Error building kubernetes clientset: %s", err.Error())
+		fatal(err, "Error building kubernetes clientset")
 	}
 
 	confClient, err := clientset.NewForConfig(cfg)
 	if err != nil {
-		glog.Fatalf("Error building conf client: %s", err.Error())
+		fatal(err, "Error building conf client")
 	}
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
@@ -49,46 +100,235 @@ func main() {
 
 	nginxBinaryPath := "/usr/sbin/nginx"
 
-	tcpServerTemplatePath := "nginx.tcpserver.tmpl"
+	nginxCapabilities, err := nginx.DetectCapabilities(nginxBinaryPath)
+	if err != nil {
+		fatal(err, "Error detecting the version and modules of NGINX")
+	}
+	klog.InfoS("Detected NGINX", "version", nginxCapabilities.Version, "plusRelease", nginxCapabilities.PlusRelease, "modules", nginxCapabilities.GetModules())
+	if err := validateNginxCapabilities(nginxCapabilities, nginxPlus); err != nil {
+		fatal(err, "NGINX can't run the agent")
+	}
+
+	var registry *prometheus.Registry
+	var managerCollector collectors.ManagerCollector = collectors.NewManagerFakeCollector()
+	var controllerCollector collectors.ControllerCollector = collectors.NewControllerFakeCollector()
+	var informerCollector collectors.InformerCollector = collectors.NewInformerFakeCollector()
+	if enablePrometheusMetrics {
+		if !nginxPlus && !nginxCapabilities.HasModule("http_stub_status") {
+			fatal(nil, "The Prometheus metrics of NGINX require ngx_http_stub_status_module", "version", nginxCapabilities.Version)
+		}
+
+		registry = prometheus.NewRegistry()
+		managerCollector = collectors.NewLocalManagerMetricsCollector()
+		if err := managerCollector.Register(registry); err != nil {
+			klog.ErrorS(err, "Error registering the NGINX manager metrics")
+		}
+
+		controllerCollector = collectors.NewControllerMetricsCollector()
+		if err := controllerCollector.Register(registry); err != nil {
+			klog.ErrorS(err, "Error registering the controller metrics")
+		}
+
+		informerCollector = collectors.NewInformerMetricsCollector()
+		if err := informerCollector.Register(registry); err != nil {
+			klog.ErrorS(err, "Error registering the informer metrics")
+		}
+
+		// must be set before the workqueue of the controller is created
+		workqueueProvider := collectors.NewWorkqueueMetricsProvider()
+		if err := workqueueProvider.Register(registry); err != nil {
+			klog.ErrorS(err, "Error registering the workqueue metrics")
+		}
+		workqueue.SetProvider(workqueueProvider)
+
+		infoCollector := collectors.NewNginxInfoCollector(nginxCapabilities.Version, nginxCapabilities.PlusRelease, nginxCapabilities.GetModules())
+		if err := infoCollector.Register(registry); err != nil {
+			klog.ErrorS(err, "Error registering the NGINX info metrics")
+		}
+	}
+
+	templateExecutor, err := version1.NewTemplateExecutor()
+	if err != nil {
+		fatal(err, "Error creating TemplateExecutor")
+	}
+
+	var nginxManager nginx.Manager
+	switch nginxManagerType {
+	case "local":
+		nginxManager = nginx.NewLocalManager("/etc/nginx/", nginxBinaryPath, managerCollector, nginxMaxRestarts)
+	case "remote":
+		nginxManager = nginx.NewRemoteManager("/etc/nginx/", nginxBinaryPath, managerCollector)
+	default:
+		fatal(nil, "Invalid value for the nginx-manager argument: expected local or remote", "nginxManager", nginxManagerType)
+	}
+
+	defaultConfigParams := configuration.NewDefaultConfigParams(formatNginxTime(workerShutdownTimeout))
+	// stub_status is only needed for the metrics of NGINX OSS, the metrics of NGINX Plus come from the API.
+	defaultConfigParams.StubStatusOnUnixSocket = enablePrometheusMetrics && !nginxPlus
+	cfgParams := defaultConfigParams
+
+	var configMapInformerFactory kubeinformers.SharedInformerFactory
+	var configMapInformer coreinformers.ConfigMapInformer
+	var configMapRef klog.ObjectRef
+	if nginxConfigMaps != "" {
+		ns, name, err := cache.SplitMetaNamespaceKey(nginxConfigMaps)
+		if err != nil || ns == "" {
+			fatal(err, "Error parsing the nginx-configmaps argument: expected namespace/name", "nginxConfigMaps", nginxConfigMaps)
+		}
+		configMapRef = klog.KRef(ns, name)
+
+		cfgm, err := kubeClient.CoreV1().ConfigMaps(ns).Get(name, meta_v1.GetOptions{})
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				fatal(err, "Error when getting the ConfigMap", "configMap", configMapRef)
+			}
+			klog.InfoS("ConfigMap doesn't exist, using the default configuration", "configMap", configMapRef)
+		} else {
+			cfgParams = configuration.ParseConfigMap(cfgm, defaultConfigParams)
+		}
+
+		configMapInformerFactory = kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Second*30,
+			kubeinformers.WithNamespace(ns),
+			kubeinformers.WithTweakListOptions(func(options *meta_v1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+			}))
+		configMapInformer = configMapInformerFactory.Core().V1().ConfigMaps()
+	}
 
-	managerCollector := collectors.NewManagerFakeCollector()
+	if cfgParams.TCPServerTemplate != "" {
+		if err := templateExecutor.UpdateTCPServerTemplate(cfgParams.TCPServerTemplate); err != nil {
+			// the error is reported again for the ConfigMap once the controller syncs it
+			klog.ErrorS(err, "Error parsing the TCPServer template, using the default template", "configMap", configMapRef)
+			cfgParams.TCPServerTemplate = ""
+		}
+	}
 
-	nginxManager := nginx.NewLocalManager("/etc/nginx/", nginxBinaryPath, managerCollector)
+	mainConfig := configuration.GenerateNginxMainConfig(cfgParams, nginxPlus)
+	content, err := templateExecutor.ExecuteMainConfigTemplate(mainConfig)
+	if err != nil {
+		fatal(err, "Error generating NGINX main config")
+	}
+	if err := nginxManager.CreateMainConfig(content); err != nil {
+		fatal(err, "Error creating NGINX main config")
+	}
 
 	// Hard coding ngxConfig.OpenTracingLoadModule = false. To keep simplicity
-	nginxManager.UpdateConfigVersionFile(false)
+	if err := nginxManager.UpdateConfigVersionFile(false); err != nil {
+		fatal(err, "Error creating NGINX config version file")
+	}
 	//nginxManager.SetOpenTracing(false)
 
+	// the agent is live while NGINX runs, and not ready until the TCPServers are applied to NGINX.
+	// The health server and the signal handler run before NGINX starts, which can take a while.
+	healthServer := health.NewServer(nginxManager.CheckHealth, nil)
+	go healthServer.Run(healthPort)
+
+	stopCh := make(chan struct{})
 	nginxDone := make(chan error, 1)
+	go startSignalHandler(stopCh, nginxManager, nginxDone, healthServer, shutdownTracing)
+
 	nginxManager.Start(nginxDone)
 
-	stopCh := make(chan struct{})
+	var plusClient *client.NginxClient
+	if nginxPlus {
+		httpClient := getSocketClient("/var/lib/nginx/nginx-plus-api.sock")
+		plusClient, err = client.NewNginxClient(httpClient, "http://nginx-plus-api/api")
+		if err != nil {
+			fatal(err, "Failed to create NginxClient for Plus")
+		}
+		nginxManager.SetPlusClients(plusClient, httpClient)
+
+		if enablePrometheusMetrics {
+			go metrics.RunPrometheusListenerForNginxPlus(prometheusMetricsListenPort, plusClient, registry)
+		}
+	} else if enablePrometheusMetrics {
+		httpClient := getSocketClient("/var/lib/nginx/nginx-status.sock")
+		metricsClient, err := metrics.NewNginxMetricsClient(httpClient)
+		if err != nil {
+			fatal(err, "Failed to create NginxClient for the metrics")
+		}
+		go metrics.RunPrometheusListenerForNginx(prometheusMetricsListenPort, metricsClient, registry)
+	}
 
-	go startSignalHandler(stopCh, nginxManager, nginxDone)
+	configurer := configuration.NewConfigurer(nginxManager, templateExecutor, cfgParams, reloadBatchWindow, nginxPlus)
 
-	templateExecutor, err := version1.NewTemplateExecutor(tcpServerTemplatePath)
-	if err != nil {
-		glog.Fatalf("Error creating TemplateExecutor: %v", err)
+	if nginxPlus && enablePrometheusMetrics {
+		tcpServerStreamCollector := collectors.NewTCPServerStreamCollector(plusClient, configurer.GetTCPServerZones)
+		if err := tcpServerStreamCollector.Register(registry); err != nil {
+			klog.ErrorS(err, "Error registering the TCPServer stream metrics")
+		}
 	}
 
-	configurer := configuration.NewConfigurer(nginxManager, templateExecutor)
+	controller := k8s.NewController(k8s.NewControllerInput{
+		KubeClient:          kubeClient,
+		ConfClient:          confClient,
+		ServiceInformer:     kubeInformerFactory.Core().V1().Services(),
+		EndpointsInformer:   kubeInformerFactory.Core().V1().Endpoints(),
+		PodInformer:         kubeInformerFactory.Core().V1().Pods(),
+		TCPServerInformer:   confInformerFactory.K8s().V1().TCPServers(),
+		ConfigMapInformer:   configMapInformer,
+		NginxConfigMaps:     nginxConfigMaps,
+		DefaultConfigParams: defaultConfigParams,
+		Configurer:          configurer,
+		EnableSnippets:      enableSnippets,
+		NginxCapabilities:   nginxCapabilities,
+		MetricsCollector:    controllerCollector,
+		InformerCollector:   informerCollector,
+	})
+
+	healthServer.SetReadyCheck(controller.CheckReady)
 
-	controller := k8s.NewController(kubeClient, confClient,
-		kubeInformerFactory.Core().V1().Services(),
-		kubeInformerFactory.Core().V1().Endpoints(),
-		kubeInformerFactory.Core().V1().Pods(),
-		confInformerFactory.K8s().V1().TCPServers(),
-		configurer)
+	if enableDebugEndpoints {
+		debugServer := debug.NewServer(configurer, controller, nginxManager)
+		go debugServer.Run(debugListenPort)
+	}
+
+	go configurer.Run(stopCh)
 
 	kubeInformerFactory.Start(stopCh)
 	confInformerFactory.Start(stopCh)
+	if configMapInformerFactory != nil {
+		configMapInformerFactory.Start(stopCh)
+	}
 
 	if err = controller.Run(2, stopCh); err != nil {
-		glog.Fatalf("Error running controller: %s", err.Error())
+		// the caches don't sync if the agent is shut down before
+		select {
+		case <-stopCh:
+		default:
+			fatal(err, "Error running controller")
+		}
 	}
+
+	// the signal handler exits once NGINX is shut down
+	select {}
 }
 
-func startSignalHandler(stop chan struct{}, nginxManager nginx.Manager, nginxDone chan error) {
+// requiredModules are the modules used by the main NGINX configuration.
+var requiredModules = []string{"stream", "stream_log", "stream_return"}
+
+// validateNginxCapabilities checks that NGINX supports the main configuration.
+func validateNginxCapabilities(capabilities *nginx.Capabilities, nginxPlus bool) error {
+	if nginxPlus && !capabilities.IsPlus() {
+		return fmt.Errorf("the nginx-plus argument is set, but NGINX %v is not NGINX Plus", capabilities.Version)
+	}
+
+	for _, module := range requiredModules {
+		if !capabilities.HasModule(module) {
+			return fmt.Errorf("NGINX %v is built without ngx_%v_module", capabilities.Version, module)
+		}
+	}
+
+	return nil
+}
+
+// startSignalHandler shuts the agent down when NGINX exits for good, after it was restarted too many times in a row,
+// or SIGTERM is received.
+// On SIGTERM, the agent first reports itself as not ready and waits for shutdownDelay,
+// so that it is removed from the Service endpoints before NGINX stops accepting connections.
+// NGINX is then quit gracefully, letting existing streams drain for up to worker_shutdown_timeout.
+// The remaining spans are exported before the agent exits.
+func startSignalHandler(stop chan struct{}, nginxManager nginx.Manager, nginxDone chan error, healthServer *health.Server, shutdownTracing func()) {
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGTERM)
@@ -98,31 +338,111 @@ func startSignalHandler(stop chan struct{}, nginxManager nginx.Manager, nginxDon
 
 	select {
 	case err := <-nginxDone:
-		if err != nil {
-			glog.Errorf("nginx command exited with an error: %v", err)
-			exitStatus = 1
-		} else {
-			glog.Info("nginx command exited successfully")
-		}
+		exitStatus = handleNginxExit(err)
 		exited = true
 	case <-c:
-		glog.Infof("Received SIGTERM, shutting down")
+		klog.InfoS("Received SIGTERM, shutting down")
+
+		healthServer.SetReady(false)
+
+		klog.InfoS("Waiting before shutting down NGINX", "delay", shutdownDelay)
+		select {
+		case err := <-nginxDone:
+			exitStatus = handleNginxExit(err)
+			exited = true
+		case <-time.After(shutdownDelay):
+		}
 	}
 
-	glog.Infof("Shutting down the controller")
+	klog.InfoS("Shutting down the controller")
 	close(stop)
 
 	if !exited {
-		glog.Infof("Shutting down NGINX")
+		klog.InfoS("Shutting down NGINX")
 		nginxManager.Quit()
 		<-nginxDone
 	}
 
-	glog.Infof("Exiting with a status: %v", exitStatus)
+	shutdownTracing()
+
+	klog.InfoS("Exiting", "status", exitStatus)
 	os.Exit(exitStatus)
 }
 
+// getSocketClient gets an http.Client with a unix socket transport.
+func getSocketClient(sockPath string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", sockPath)
+			},
+		},
+	}
+}
+
+// fatal logs the error with the key/value pairs, and exits.
+func fatal(err error, msg string, keysAndValues ...interface{}) {
+	klog.ErrorS(err, msg, keysAndValues...)
+	klog.Flush()
+	os.Exit(1)
+}
+
+func handleNginxExit(err error) int {
+	if err != nil {
+		klog.ErrorS(err, "nginx command exited with an error")
+		return 1
+	}
+
+	klog.InfoS("nginx command exited successfully")
+	return 0
+}
+
+// formatNginxTime formats d as an NGINX time value in seconds. Returns an empty string if d is not positive.
+func formatNginxTime(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%ds", int64(d/time.Second))
+}
+
 func init() {
+	klog.InitFlags(nil)
+
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	flag.IntVar(&healthPort, "health-port", 8081, "The port of the liveness endpoint /healthz and the readiness endpoint /readyz.")
+	flag.DurationVar(&shutdownDelay, "shutdown-delay", 10*time.Second,
+		"How long to report the agent as not ready on SIGTERM before quitting NGINX. Should exceed the readiness probe period.")
+	flag.DurationVar(&workerShutdownTimeout, "worker-shutdown-timeout", 30*time.Second,
+		"Bounds how long NGINX lets existing streams drain on shutdown (worker_shutdown_timeout). 0 waits for all streams to finish.")
+	flag.DurationVar(&reloadBatchWindow, "reload-batch-window", 500*time.Millisecond,
+		"How long to collect TCPServer changes before applying them to NGINX with a single reload.")
+	flag.StringVar(&nginxConfigMaps, "nginx-configmaps", "",
+		"A ConfigMap resource for customizing NGINX configuration, in the format <namespace>/<name>. If not set, the default configuration is used.")
+	flag.BoolVar(&nginxPlus, "nginx-plus", false,
+		"Enable support for NGINX Plus. Endpoint changes are then applied through the NGINX Plus API, without a reload.")
+	flag.StringVar(&nginxManagerType, "nginx-manager", "local",
+		"How the agent runs NGINX: local starts NGINX in the agent's container, remote manages NGINX running in another container of the Pod, "+
+			"through volumes and a process namespace shared with it. See deployments/deployment/kube-agent-sidecar.yaml.")
+	flag.IntVar(&nginxMaxRestarts, "nginx-max-restarts", 5,
+		"How many times in a row NGINX is restarted after exiting unexpectedly before the agent exits. NGINX running for a minute after a restart resets the count.")
+	flag.BoolVar(&enableSnippets, "enable-snippets", false,
+		"Enable the serverSnippets and upstreamSnippets of the TCPServers. Snippets let the users of TCPServers add any NGINX directive.")
+	flag.BoolVar(&enablePrometheusMetrics, "enable-prometheus-metrics", false,
+		"Expose the metrics of NGINX and the agent in the Prometheus format on /metrics.")
+	flag.IntVar(&prometheusMetricsListenPort, "prometheus-metrics-listen-port", 9113,
+		"The port of the Prometheus metrics endpoint /metrics.")
+	flag.BoolVar(&enableDebugEndpoints, "enable-debug-endpoints", false,
+		"Expose the TCPServers in NGINX, their rendered configs, the reasons the endpoints of their services are upstream servers or not, "+
+			"and the config version of NGINX under /debug/, on the loopback interface only.")
+	flag.IntVar(&debugListenPort, "debug-listen-port", 8082,
+		"The port of the debug endpoints.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "",
+		"The host:port of an OpenTelemetry collector to export the spans of the TCPServer syncs, the NGINX config writes and the reloads to, "+
+			"over OTLP with gRPC. If not set, the spans are not recorded.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false,
+		"Connect to the OpenTelemetry collector of otlp-endpoint without TLS.")
+	flag.StringVar(&logFormat, "log-format", logFormatText,
+		"The format of the logs: text or json. The json format writes one object per line, with the TCPServer, the config version and the other fields of a log as keys.")
 }
@@ -4,7 +4,7 @@ go 1.13
 
 require (
 	github.com/evanphx/json-patch v4.5.0+incompatible // indirect
-	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
+	github.com/go-logr/zapr v0.2.0
 	github.com/golang/groupcache v0.0.0-20191027212112-611e8accdfc9 // indirect
 	github.com/googleapis/gnostic v0.3.1 // indirect
 	github.com/hashicorp/golang-lru v0.5.3 // indirect
@@ -13,6 +13,10 @@ require (
 	github.com/nginxinc/nginx-prometheus-exporter v0.4.2
 	github.com/prometheus/client_golang v1.2.1
 	github.com/prometheus/procfs v0.0.6 // indirect
+	go.opentelemetry.io/otel v0.15.0
+	go.opentelemetry.io/otel/exporters/otlp v0.15.0
+	go.opentelemetry.io/otel/sdk v0.15.0
+	go.uber.org/zap v1.16.0
 	golang.org/x/crypto v0.0.0-20191108234033-bd318be0434a // indirect
 	golang.org/x/net v0.0.0-20191112182307-2180aed22343 // indirect
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d // indirect
@@ -25,5 +29,6 @@ require (
 	k8s.io/client-go v0.0.0-20200118233946-a432bd9ba7da
 	k8s.io/code-generator v0.18.0-alpha.2.0.20200122224840-a8714d90d04c
 	k8s.io/gengo v0.0.0-20191108084044-e500ee069b5c // indirect
+	k8s.io/klog/v2 v2.4.0
 	k8s.io/utils v0.0.0-20200109141947-94aeca20bf09 // indirect
 )
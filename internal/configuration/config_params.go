@@ -0,0 +1,166 @@
+package configuration
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/mohamed-gougam/kube-agent/internal/configuration/version1"
+)
+
+// defaultStreamLogFormat is the format of the stream access log if the ConfigMap doesn't set one.
+const defaultStreamLogFormat = `$remote_addr [$time_local] $protocol $status $bytes_sent $bytes_received $session_time "$upstream_addr" $tcpserver_namespace/$tcpserver_name`
+
+// defaultStreamJSONLogFormat is the format of the stream access log if the ConfigMap sets the json type but no format.
+const defaultStreamJSONLogFormat = `{"time":"$time_iso8601","remote_addr":"$remote_addr","protocol":"$protocol","status":"$status",` +
+	`"bytes_sent":"$bytes_sent","bytes_received":"$bytes_received","session_time":"$session_time","upstream_addr":"$upstream_addr",` +
+	`"tcpserver_namespace":"$tcpserver_namespace","tcpserver_name":"$tcpserver_name"}`
+
+// defaultStreamAccessLog is the destination of the stream access log if the ConfigMap doesn't set one.
+const defaultStreamAccessLog = "/dev/stdout"
+
+// ConfigParams holds the global NGINX configuration parameters, set through the ConfigMap.
+type ConfigParams struct {
+	WorkerProcesses       string
+	WorkerConnections     string
+	WorkerRlimitNofile    string
+	WorkerShutdownTimeout string
+	ErrorLogLevel         string
+	StreamLogFormat       string
+	// StreamLogFormatEscaping is the escape parameter of the stream log_format, "json" for the json type.
+	StreamLogFormatEscaping string
+	StreamAccessLog         string
+	ResolverAddresses       []string
+	ResolverValid           string
+	ResolverTimeout         string
+	// TCPServerTemplate replaces the default TCPServer template if not empty.
+	TCPServerTemplate string
+	// StubStatusOnUnixSocket exposes stub_status for the Prometheus metrics. It is set by the arguments of the agent,
+	// not through the ConfigMap.
+	StubStatusOnUnixSocket bool
+}
+
+// NewDefaultConfigParams creates a ConfigParams with the default values.
+func NewDefaultConfigParams(workerShutdownTimeout string) *ConfigParams {
+	return &ConfigParams{
+		WorkerProcesses:       "1",
+		WorkerConnections:     "1024",
+		WorkerShutdownTimeout: workerShutdownTimeout,
+		ErrorLogLevel:         "warn",
+		StreamLogFormat:       defaultStreamLogFormat,
+		StreamAccessLog:       defaultStreamAccessLog,
+	}
+}
+
+// ParseConfigMap parses the ConfigMap into ConfigParams. Keys that are not set keep the values of defaults.
+func ParseConfigMap(cfgm *v1.ConfigMap, defaults *ConfigParams) *ConfigParams {
+	cfgParams := *defaults
+
+	if workerProcesses, exists := cfgm.Data["worker-processes"]; exists {
+		cfgParams.WorkerProcesses = workerProcesses
+	}
+
+	if workerConnections, exists := cfgm.Data["worker-connections"]; exists {
+		cfgParams.WorkerConnections = workerConnections
+	}
+
+	if workerRlimitNofile, exists := cfgm.Data["worker-rlimit-nofile"]; exists {
+		cfgParams.WorkerRlimitNofile = workerRlimitNofile
+	}
+
+	if workerShutdownTimeout, exists := cfgm.Data["worker-shutdown-timeout"]; exists {
+		cfgParams.WorkerShutdownTimeout = workerShutdownTimeout
+	}
+
+	if errorLogLevel, exists := cfgm.Data["error-log-level"]; exists {
+		cfgParams.ErrorLogLevel = errorLogLevel
+	}
+
+	if streamLogFormatType, exists := cfgm.Data["stream-log-format-type"]; exists {
+		switch streamLogFormatType {
+		case "text":
+			cfgParams.StreamLogFormatEscaping = ""
+		case "json":
+			cfgParams.StreamLogFormatEscaping = "json"
+			cfgParams.StreamLogFormat = defaultStreamJSONLogFormat
+		default:
+			klog.ErrorS(nil, "Invalid value in ConfigMap: expected text or json", "configMap", klog.KObj(cfgm), "key", "stream-log-format-type", "value", streamLogFormatType)
+		}
+	}
+
+	if streamLogFormat, exists := cfgm.Data["stream-log-format"]; exists {
+		// the log format is quoted with single quotes in the config
+		if strings.ContainsAny(streamLogFormat, `'\`) {
+			klog.ErrorS(nil, "Invalid value in ConfigMap: single quotes and backslashes are not allowed", "configMap", klog.KObj(cfgm), "key", "stream-log-format", "value", streamLogFormat)
+		} else {
+			cfgParams.StreamLogFormat = streamLogFormat
+		}
+	}
+
+	if streamAccessLog, exists := cfgm.Data["stream-access-log"]; exists {
+		cfgParams.StreamAccessLog = streamAccessLog
+	}
+
+	if resolverAddresses, exists := cfgm.Data["resolver-addresses"]; exists {
+		cfgParams.ResolverAddresses = nil
+		for _, address := range strings.Split(resolverAddresses, ",") {
+			address = strings.TrimSpace(address)
+			if address == "" {
+				klog.ErrorS(nil, "Invalid value in ConfigMap: empty address", "configMap", klog.KObj(cfgm), "key", "resolver-addresses", "value", resolverAddresses)
+				continue
+			}
+			cfgParams.ResolverAddresses = append(cfgParams.ResolverAddresses, address)
+		}
+	}
+
+	if resolverValid, exists := cfgm.Data["resolver-valid"]; exists {
+		cfgParams.ResolverValid = resolverValid
+	}
+
+	if resolverTimeout, exists := cfgm.Data["resolver-timeout"]; exists {
+		cfgParams.ResolverTimeout = resolverTimeout
+	}
+
+	if tcpServerTemplate, exists := cfgm.Data["tcpserver-template"]; exists {
+		cfgParams.TCPServerTemplate = tcpServerTemplate
+	}
+
+	return &cfgParams
+}
+
+// tcpServerConfigParamsChanged returns true if the configs of the TCPServers rendered with the ConfigParams
+// differ from the configs rendered with the previous ConfigParams.
+func tcpServerConfigParamsChanged(prev *ConfigParams, cfgParams *ConfigParams) bool {
+	return prev.StreamLogFormat != cfgParams.StreamLogFormat ||
+		prev.StreamLogFormatEscaping != cfgParams.StreamLogFormatEscaping ||
+		prev.StreamAccessLog != cfgParams.StreamAccessLog
+}
+
+// generateStreamLogFormat replaces the $tcpserver_namespace and $tcpserver_name variables of the log format
+// with the namespace and the name of a TCPServer. They are not NGINX variables.
+func generateStreamLogFormat(format string, namespace string, name string) string {
+	// $tcpserver_name is a prefix of $tcpserver_namespace, so $tcpserver_namespace must be replaced first.
+	replacer := strings.NewReplacer("$tcpserver_namespace", namespace, "$tcpserver_name", name)
+	return replacer.Replace(format)
+}
+
+// GenerateNginxMainConfig generates the main NGINX configuration from the ConfigParams.
+func GenerateNginxMainConfig(cfgParams *ConfigParams, isPlus bool) *version1.MainConfig {
+	return &version1.MainConfig{
+		NginxPlus:              isPlus,
+		StubStatusOnUnixSocket: cfgParams.StubStatusOnUnixSocket,
+		WorkerProcesses:        cfgParams.WorkerProcesses,
+		WorkerConnections:      cfgParams.WorkerConnections,
+		WorkerRlimitNofile:     cfgParams.WorkerRlimitNofile,
+		WorkerShutdownTimeout:  cfgParams.WorkerShutdownTimeout,
+		ErrorLogLevel:          cfgParams.ErrorLogLevel,
+		// the stream access log of the main config is only used by the servers that are not TCPServers.
+		StreamLogFormat:         generateStreamLogFormat(cfgParams.StreamLogFormat, "-", "-"),
+		StreamLogFormatEscaping: cfgParams.StreamLogFormatEscaping,
+		StreamAccessLog:         cfgParams.StreamAccessLog,
+		ResolverAddresses:       cfgParams.ResolverAddresses,
+		ResolverValid:           cfgParams.ResolverValid,
+		ResolverTimeout:         cfgParams.ResolverTimeout,
+	}
+}
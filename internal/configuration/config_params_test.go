@@ -0,0 +1,105 @@
+package configuration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mohamed-gougam/kube-agent/internal/configuration/version1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseConfigMap(t *testing.T) {
+	defaults := NewDefaultConfigParams("30s")
+
+	cfgm := &v1.ConfigMap{
+		Data: map[string]string{
+			"worker-processes":       "auto",
+			"error-log-level":        "info",
+			"stream-access-log":      "syslog:server=10.0.0.1",
+			"stream-log-format-type": "json",
+			"resolver-addresses":     "10.0.0.10, 10.0.0.11",
+		},
+	}
+
+	expected := *defaults
+	expected.WorkerProcesses = "auto"
+	expected.ErrorLogLevel = "info"
+	expected.StreamAccessLog = "syslog:server=10.0.0.1"
+	expected.StreamLogFormat = defaultStreamJSONLogFormat
+	expected.StreamLogFormatEscaping = "json"
+	expected.ResolverAddresses = []string{"10.0.0.10", "10.0.0.11"}
+
+	result := ParseConfigMap(cfgm, defaults)
+	if !reflect.DeepEqual(result, &expected) {
+		t.Errorf("ParseConfigMap() returned %+v, expected %+v", result, expected)
+	}
+
+	if defaults.WorkerProcesses != "1" {
+		t.Errorf("ParseConfigMap() changed the defaults: %+v", defaults)
+	}
+}
+
+func TestParseConfigMapRejectsQuotesInStreamLogFormat(t *testing.T) {
+	defaults := NewDefaultConfigParams("30s")
+
+	for _, format := range []string{`$remote_addr'; include /etc/passwd; #`, `$remote_addr \' $status`} {
+		cfgm := &v1.ConfigMap{
+			Data: map[string]string{
+				"stream-log-format": format,
+			},
+		}
+
+		result := ParseConfigMap(cfgm, defaults)
+		if result.StreamLogFormat != defaults.StreamLogFormat {
+			t.Errorf("ParseConfigMap() returned the stream log format %q for %q, expected the default %q", result.StreamLogFormat, format, defaults.StreamLogFormat)
+		}
+	}
+}
+
+func TestGenerateStreamLogFormat(t *testing.T) {
+	format := `$remote_addr "$tcpserver_namespace" "$tcpserver_name" $tcpserver_namespace/$tcpserver_name`
+	expected := `$remote_addr "default" "coffee" default/coffee`
+
+	result := generateStreamLogFormat(format, "default", "coffee")
+	if result != expected {
+		t.Errorf("generateStreamLogFormat() returned %q, expected %q", result, expected)
+	}
+}
+
+func TestGenerateNginxMainConfigStubStatus(t *testing.T) {
+	templateExecutor, err := version1.NewTemplateExecutor()
+	if err != nil {
+		t.Fatalf("NewTemplateExecutor() returned unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		stubStatusOnUnixSocket bool
+		msg                    string
+	}{
+		{
+			stubStatusOnUnixSocket: true,
+			msg:                    "the Prometheus metrics of NGINX",
+		},
+		{
+			stubStatusOnUnixSocket: false,
+			msg:                    "no Prometheus metrics",
+		},
+	}
+
+	for _, test := range tests {
+		cfgParams := NewDefaultConfigParams("30s")
+		cfgParams.StubStatusOnUnixSocket = test.stubStatusOnUnixSocket
+
+		content, err := templateExecutor.ExecuteMainConfigTemplate(GenerateNginxMainConfig(cfgParams, false))
+		if err != nil {
+			t.Fatalf("ExecuteMainConfigTemplate() returned unexpected error for the case of %s: %v", test.msg, err)
+		}
+
+		result := strings.Contains(string(content), "listen unix:/var/lib/nginx/nginx-status.sock;") &&
+			strings.Contains(string(content), "stub_status;")
+		if result != test.stubStatusOnUnixSocket {
+			t.Errorf("the main config has the stub_status server %v for the case of %s, expected %v", result, test.msg, test.stubStatusOnUnixSocket)
+		}
+	}
+}
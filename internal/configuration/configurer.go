@@ -1,72 +1,632 @@
 package configuration
 
 import (
+	"context"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
 
 	"github.com/mohamed-gougam/kube-agent/internal/configuration/version1"
 	"github.com/mohamed-gougam/kube-agent/internal/nginx"
+	"github.com/mohamed-gougam/kube-agent/internal/tracing"
 	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
 )
 
-// Configurer configures NGINX
+// ApplyHandler is called with the result of applying the configuration of a TCPServer to NGINX.
+// tcpServerEx is nil if the configuration of the TCPServer was deleted.
+// eventTime is the time of the earliest event the change was queued for.
+// err is a *nginx.RollbackError if NGINX was rolled back to the configuration from before the change.
+type ApplyHandler func(key string, tcpServerEx *TCPServerEx, eventTime time.Time, err error)
+
+// tcpServerChange is a rendered TCPServer configuration waiting to be applied to NGINX.
+type tcpServerChange struct {
+	key         string
+	name        string
+	content     []byte
+	tcpServerEx *TCPServerEx
+	// renderGeneration is the generation of the TCPServer template and ConfigParams the content was rendered with.
+	renderGeneration int32
+	// eventTime is the time of the earliest event the change was queued for.
+	eventTime time.Time
+	// spanContexts are the spans the change, and the changes it replaced, were queued in. They are linked to the span
+	// of the batch that applies the change.
+	spanContexts []trace.SpanContext
+}
+
+// Configurer configures NGINX.
+// TCPServer configs are rendered by the callers of AddOrUpdateTCPServer, concurrently.
+// The rendered configs are applied to NGINX by a single goroutine, Run, in batches:
+// for a given TCPServer, changes are applied in the order they were queued, and a batch is only
+// applied once the previous one is live in NGINX.
+// Updating the configuration, through UpdateConfig, is serialized with applying the batches.
 type Configurer struct {
 	nginxManager     nginx.Manager
+	configLock       sync.Mutex
+	tcpServersLock   sync.RWMutex
 	tcpServersEx     map[string]*TCPServerEx
 	templateExecutor *version1.TemplateExecutor
+	cfgParamsLock    sync.RWMutex
+	cfgParams        *ConfigParams
+	renderGeneration int32
+	isPlus           bool
+	applyHandler     ApplyHandler
+	batchWindow      time.Duration
+	pendingLock      sync.Mutex
+	pending          map[string]*tcpServerChange
+	pendingCh        chan struct{}
 }
 
-// NewConfigurer return a new Configurer.
-func NewConfigurer(nginxManager nginx.Manager, templateExecutor *version1.TemplateExecutor) *Configurer {
+// NewConfigurer return a new Configurer. Changes queued within batchWindow are applied to NGINX with a single reload.
+// With NGINX Plus, changes that only update the endpoints of TCPServers are applied through the NGINX Plus API,
+// without a reload. cfgParams are the ConfigParams NGINX runs with, and the TCPServer template of the templateExecutor
+// must be the one of cfgParams.
+func NewConfigurer(nginxManager nginx.Manager, templateExecutor *version1.TemplateExecutor, cfgParams *ConfigParams, batchWindow time.Duration, isPlus bool) *Configurer {
 	return &Configurer{
 		nginxManager:     nginxManager,
 		tcpServersEx:     make(map[string]*TCPServerEx),
 		templateExecutor: templateExecutor,
+		cfgParams:        cfgParams,
+		isPlus:           isPlus,
+		batchWindow:      batchWindow,
+		pending:          make(map[string]*tcpServerChange),
+		pendingCh:        make(chan struct{}, 1),
+	}
+}
+
+// SetApplyHandler sets the handler that receives the result of applying every queued change.
+// It must be called before Run.
+func (cgr *Configurer) SetApplyHandler(handler ApplyHandler) {
+	cgr.applyHandler = handler
+}
+
+// AddOrUpdateTCPServer renders the config of the TCPServer and queues it to be applied to NGINX.
+// eventTime is the time of the event the TCPServer is updated for.
+// The result of applying it is reported to the ApplyHandler.
+func (cgr *Configurer) AddOrUpdateTCPServer(ctx context.Context, tcpServerEx *TCPServerEx, eventTime time.Time) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Configurer.AddOrUpdateTCPServer", trace.WithAttributes(
+		append(tracing.TCPServerAttributes(tcpServerEx.TCPServer), tracing.TCPServerUpstreamsKey.Int(len(tcpServerEx.ServiceAddresses)))...))
+	defer span.End()
+
+	// the generation must be read before rendering, so that a template or ConfigParams swapped during rendering
+	// make the change stale.
+	renderGeneration := atomic.LoadInt32(&cgr.renderGeneration)
+
+	_, renderSpan := tracing.Tracer().Start(ctx, "Configurer.renderTCPServer")
+	nginxConfig, err := cgr.renderTCPServer(tcpServerEx)
+	tracing.SetError(renderSpan, err)
+	renderSpan.End()
+	if err != nil {
+		tracing.SetError(span, err)
+		return err
+	}
+
+	cgr.queueChange(&tcpServerChange{
+		key:              getKeyForTCPServer(tcpServerEx.TCPServer),
+		name:             getFileNameForTCPServer(tcpServerEx.TCPServer),
+		content:          nginxConfig,
+		tcpServerEx:      tcpServerEx,
+		renderGeneration: renderGeneration,
+		eventTime:        eventTime,
+		spanContexts:     []trace.SpanContext{span.SpanContext()},
+	})
+
+	return nil
+}
+
+func (cgr *Configurer) renderTCPServer(tcpServerEx *TCPServerEx) ([]byte, error) {
+	cfg := generateNginxTCPServerCfg(tcpServerEx, cgr.getConfigParams(), cgr.isPlus)
+	nginxConfig, err := cgr.templateExecutor.ExecuteTCPServerConfigTemplate(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Error generating TCPServer Config %v: %v", getFileNameForTCPServer(tcpServerEx.TCPServer), err)
 	}
+
+	return nginxConfig, nil
 }
 
-// AddOrUpdateTCPServer adds TCPServer to nginx's config
-func (cgr *Configurer) AddOrUpdateTCPServer(tcpServerEx *TCPServerEx) error {
+// DeleteTCPServer queues the removal of the NGINX configuration of the TCPServer.
+// eventTime is the time of the event the TCPServer is removed for.
+// The result of removing it is reported to the ApplyHandler.
+func (cgr *Configurer) DeleteTCPServer(ctx context.Context, key string, eventTime time.Time) {
+	cgr.queueChange(&tcpServerChange{
+		key:          key,
+		name:         getFileNameForTCPServerFromKey(key),
+		eventTime:    eventTime,
+		spanContexts: []trace.SpanContext{trace.SpanContextFromContext(ctx)},
+	})
+}
+
+// queueChange queues the change, replacing any change of the same TCPServer that wasn't applied yet.
+// The change keeps the event time and the spans of the replaced change, as it also applies the event of the replaced change.
+func (cgr *Configurer) queueChange(change *tcpServerChange) {
+	cgr.pendingLock.Lock()
+	if prev, exists := cgr.pending[change.key]; exists {
+		if prev.eventTime.Before(change.eventTime) {
+			change.eventTime = prev.eventTime
+		}
+		change.spanContexts = append(prev.spanContexts, change.spanContexts...)
+	}
+	cgr.pending[change.key] = change
+	cgr.pendingLock.Unlock()
 
-	if err := cgr.addOrUpdateTCPServer(tcpServerEx); err != nil {
-		return fmt.Errorf("Error adding or updating TCPServer %v/%v: %v", tcpServerEx.TCPServer.Namespace, tcpServerEx.TCPServer.Name, err)
+	select {
+	case cgr.pendingCh <- struct{}{}:
+	default:
 	}
+}
+
+func (cgr *Configurer) takePendingChanges() []*tcpServerChange {
+	cgr.pendingLock.Lock()
+	defer cgr.pendingLock.Unlock()
 
-	if err := cgr.nginxManager.Reload(); err != nil {
-		return fmt.Errorf("Error reloading NGINX for %v/%v: %v", tcpServerEx.TCPServer.Namespace, tcpServerEx.TCPServer.Name, err)
+	var changes []*tcpServerChange
+	for _, change := range cgr.pending {
+		changes = append(changes, change)
+	}
+	cgr.pending = make(map[string]*tcpServerChange)
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].key < changes[j].key
+	})
+
+	return changes
+}
+
+// Run applies the queued changes to NGINX until stopCh is closed.
+// Once a change is queued, Run waits for the batch window and applies every change queued so far with a single reload.
+// Run must be called only once.
+func (cgr *Configurer) Run(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-cgr.pendingCh:
+		case <-stopCh:
+			return
+		}
+
+		select {
+		case <-time.After(cgr.batchWindow):
+		case <-stopCh:
+			return
+		}
+
+		changes := cgr.takePendingChanges()
+		if len(changes) == 0 {
+			continue
+		}
+
+		cgr.applyChanges(changes)
+	}
+}
+
+// applyChanges applies the changes to NGINX with a single reload. If the NGINX configuration test attributes its
+// errors to the configs of some of the changes, those changes are rejected and the remaining ones are applied.
+func (cgr *Configurer) applyChanges(changes []*tcpServerChange) {
+	// a batch applies the changes queued by several syncs, so its span is a new trace linked to the spans of the changes
+	ctx, span := tracing.Tracer().Start(context.Background(), "Configurer.applyChanges",
+		trace.WithLinks(getChangeLinks(changes)...),
+		trace.WithAttributes(tracing.TCPServersKey.Array(getChangeKeys(changes))))
+	defer span.End()
+
+	cgr.configLock.Lock()
+	defer cgr.configLock.Unlock()
+
+	changes = cgr.rerenderStaleChanges(changes)
+
+	if cgr.isPlus {
+		changes = cgr.applyEndpointsChangesInPlus(ctx, changes)
+	}
+
+	cgr.applyBatch(ctx, changes)
+}
+
+// applyBatch applies the changes to NGINX with a single reload. If the NGINX configuration test attributes its errors
+// to the configs of some of the changes, those changes are rejected and the remaining ones are applied. If it attributes
+// them to no change, or if NGINX fails to reload with the changes and is rolled back, the changes are split in halves
+// applied one after the other, down to the changes that fail.
+func (cgr *Configurer) applyBatch(ctx context.Context, changes []*tcpServerChange) {
+	span := trace.SpanFromContext(ctx)
+
+	for len(changes) > 0 {
+		klog.V(3).InfoS("Reloading NGINX to apply TCPServer changes", "changes", len(changes))
+
+		err := cgr.nginxManager.ApplyConfigs(ctx, getConfigChanges(changes))
+		tracing.SetError(span, err)
+
+		if _, isRollbackErr := err.(*nginx.RollbackError); isRollbackErr && len(changes) > 1 {
+			// a reload failure, like a listen port NGINX can't bind, isn't attributed to a config
+			klog.InfoS("Splitting the TCPServer changes, NGINX failed to reload with them", "tcpservers", getChangeKeys(changes), "err", err)
+			cgr.splitBatch(ctx, changes)
+			return
+		}
+
+		if isConfigKeptError(err) {
+			// NGINX runs the configuration from before the changes
+			cgr.reportResults(changes, err)
+			return
+		}
+
+		testErr, isTestErr := err.(*nginx.ConfigTestError)
+		if !isTestErr {
+			if err != nil {
+				// the changes are not live in NGINX, so the TCPServers in NGINX are kept as they were
+				cgr.reportResults(changes, fmt.Errorf("Error reloading NGINX: %v", err))
+				return
+			}
+			cgr.updateTCPServersEx(changes)
+			cgr.reportResults(changes, nil)
+			return
+		}
+
+		rejected, remaining := splitChangesByName(changes, testErr.Names)
+		if len(rejected) == 0 {
+			if len(changes) == 1 {
+				cgr.reportResults(changes, fmt.Errorf("Error testing NGINX configuration: %v", testErr.Output))
+				return
+			}
+
+			// the errors are in the main config or in the config of a TCPServer outside of the batch, like a listen port
+			// that the config of a TCPServer in NGINX already uses
+			klog.InfoS("Splitting the TCPServer changes, the NGINX configuration test failed outside of their configs",
+				"tcpservers", getChangeKeys(changes), "output", testErr.Output)
+			cgr.splitBatch(ctx, changes)
+			return
+		}
+
+		klog.InfoS("Rejecting TCPServer changes that failed the NGINX configuration test", "tcpservers", getChangeKeys(rejected), "output", testErr.Output)
+		cgr.reportResults(rejected, fmt.Errorf("Invalid NGINX configuration: %v", testErr.Output))
+
+		changes = remaining
+	}
+}
+
+// splitBatch applies each half of the changes with its own reload.
+func (cgr *Configurer) splitBatch(ctx context.Context, changes []*tcpServerChange) {
+	half := len(changes) / 2
+	cgr.applyBatch(ctx, changes[:half])
+	cgr.applyBatch(ctx, changes[half:])
+}
+
+// rerenderStaleChanges renders again the changes that were rendered with a previous TCPServer template or ConfigParams.
+// Returns the changes that are ready to be applied.
+func (cgr *Configurer) rerenderStaleChanges(changes []*tcpServerChange) []*tcpServerChange {
+	renderGeneration := atomic.LoadInt32(&cgr.renderGeneration)
+
+	var ready []*tcpServerChange
+	for _, change := range changes {
+		if change.tcpServerEx == nil || change.renderGeneration == renderGeneration {
+			ready = append(ready, change)
+			continue
+		}
+
+		content, err := cgr.renderTCPServer(change.tcpServerEx)
+		if err != nil {
+			cgr.reportResults([]*tcpServerChange{change}, err)
+			continue
+		}
+
+		change.content = content
+		change.renderGeneration = renderGeneration
+		ready = append(ready, change)
+	}
+
+	return ready
+}
+
+// applyEndpointsChangesInPlus updates the upstream servers through the NGINX Plus API, if none of the changes
+// requires a reload. The configs of the changes are tested and written first, with a single configuration test,
+// so that NGINX Plus never runs upstream servers that its config files don't have.
+// Returns the changes that still need to be applied with a reload.
+func (cgr *Configurer) applyEndpointsChangesInPlus(ctx context.Context, changes []*tcpServerChange) []*tcpServerChange {
+	for _, change := range changes {
+		if !cgr.isEndpointsChange(change) {
+			return changes
+		}
+	}
+
+	// keeps the config files, and the last good configuration, up to date for the next reload or rollback
+	if err := cgr.nginxManager.WriteConfigsWithoutReload(getConfigChanges(changes)); err != nil {
+		klog.ErrorS(err, "Error writing the configs of the endpoints changes, falling back to a reload", "tcpservers", getChangeKeys(changes))
+		return changes
+	}
+
+	var remaining []*tcpServerChange
+	for _, change := range changes {
+		if err := cgr.updateServersInPlus(ctx, change); err != nil {
+			klog.ErrorS(err, "Error updating the servers through the NGINX Plus API, falling back to a reload", "tcpserver", klog.KObj(change.tcpServerEx.TCPServer))
+			remaining = append(remaining, change)
+			continue
+		}
+
+		cgr.updateTCPServersEx([]*tcpServerChange{change})
+		cgr.reportResults([]*tcpServerChange{change}, nil)
+	}
+
+	return remaining
+}
+
+// isEndpointsChange checks if the change only updates the endpoints of a TCPServer that is already applied to NGINX.
+func (cgr *Configurer) isEndpointsChange(change *tcpServerChange) bool {
+	if change.tcpServerEx == nil {
+		return false
+	}
+
+	applied, exists := cgr.GetTCPServerEx(change.key)
+	if !exists {
+		return false
+	}
+
+	return reflect.DeepEqual(applied.TCPServer.Spec, change.tcpServerEx.TCPServer.Spec)
+}
+
+func (cgr *Configurer) updateServersInPlus(ctx context.Context, change *tcpServerChange) (err error) {
+	_, span := tracing.Tracer().Start(ctx, "Configurer.updateServersInPlus", trace.WithAttributes(tracing.TCPServerKey.String(change.key)))
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
+
+	cfg := generateNginxTCPServerCfg(change.tcpServerEx, cgr.getConfigParams(), cgr.isPlus)
+
+	return cgr.nginxManager.UpdateServersInPlus(cfg.Upstream.Name, getUpstreamServerAddresses(cfg.Upstream), defaultPlusServerConfig)
+}
+
+func (cgr *Configurer) updateTCPServersEx(changes []*tcpServerChange) {
+	cgr.tcpServersLock.Lock()
+	defer cgr.tcpServersLock.Unlock()
+
+	for _, change := range changes {
+		if change.tcpServerEx == nil {
+			delete(cgr.tcpServersEx, change.key)
+			continue
+		}
+		cgr.tcpServersEx[change.key] = change.tcpServerEx
+	}
+}
+
+func (cgr *Configurer) reportResults(changes []*tcpServerChange, err error) {
+	if cgr.applyHandler == nil {
+		return
+	}
+
+	for _, change := range changes {
+		cgr.applyHandler(change.key, change.tcpServerEx, change.eventTime, err)
+	}
+}
+
+// isConfigKeptError checks if the error means that NGINX runs the configuration from before the changes.
+func isConfigKeptError(err error) bool {
+	switch err.(type) {
+	case *nginx.RollbackError, *nginx.WriteError:
+		return true
+	}
+	return false
+}
+
+// getConfigChanges returns the config changes of NGINX for the changes.
+func getConfigChanges(changes []*tcpServerChange) []nginx.ConfigChange {
+	var configChanges []nginx.ConfigChange
+	for _, change := range changes {
+		configChanges = append(configChanges, nginx.ConfigChange{
+			Name:    change.name,
+			Content: change.content,
+		})
+	}
+
+	return configChanges
+}
+
+// splitChangesByName splits the changes into the changes of the configs with the names and the remaining changes.
+func splitChangesByName(changes []*tcpServerChange, names []string) (matching []*tcpServerChange, remaining []*tcpServerChange) {
+	nameSet := make(map[string]bool)
+	for _, name := range names {
+		nameSet[name] = true
+	}
+
+	for _, change := range changes {
+		if nameSet[change.name] {
+			matching = append(matching, change)
+			continue
+		}
+		remaining = append(remaining, change)
+	}
+
+	return matching, remaining
+}
+
+// getChangeLinks returns the links to the spans the changes were queued in.
+func getChangeLinks(changes []*tcpServerChange) []trace.Link {
+	var links []trace.Link
+	for _, change := range changes {
+		for _, spanContext := range change.spanContexts {
+			if spanContext.IsValid() {
+				links = append(links, trace.Link{
+					SpanContext: spanContext,
+					Attributes:  []label.KeyValue{tracing.TCPServerKey.String(change.key)},
+				})
+			}
+		}
+	}
+
+	return links
+}
+
+// getChangeKeys returns the keys of the TCPServers of the changes.
+func getChangeKeys(changes []*tcpServerChange) []string {
+	var keys []string
+	for _, change := range changes {
+		keys = append(keys, change.key)
+	}
+	return keys
+}
+
+// UpdateConfig applies the main NGINX configuration generated from the ConfigParams. If the ConfigParams change
+// the TCPServer template or the access log, the configs of all TCPServers are rendered again.
+// If the new template fails to parse or execute, or the new configuration can't be applied, the previous template
+// and ConfigParams are kept.
+func (cgr *Configurer) UpdateConfig(cfgParams *ConfigParams) error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "Configurer.UpdateConfig")
+	defer span.End()
+
+	cgr.configLock.Lock()
+	defer cgr.configLock.Unlock()
+
+	// a copy, so that the caller changing cfgParams later doesn't change the applied ConfigParams.
+	cfgParamsCopy := *cfgParams
+	cfgParams = &cfgParamsCopy
+
+	prevCfgParams := cgr.getConfigParams()
+
+	templateChanged := cfgParams.TCPServerTemplate != prevCfgParams.TCPServerTemplate
+	if templateChanged {
+		if err := cgr.templateExecutor.UpdateTCPServerTemplate(cfgParams.TCPServerTemplate); err != nil {
+			return fmt.Errorf("Error parsing TCPServer template: %v", err)
+		}
+
+		// the TCPServers are rendered with the template only if there are any, so the template is checked on its own
+		sampleCfg := generateNginxTCPServerCfg(sampleTCPServerEx, cfgParams, cgr.isPlus)
+		if _, err := cgr.templateExecutor.ExecuteTCPServerConfigTemplate(sampleCfg); err != nil {
+			if restoreErr := cgr.templateExecutor.UpdateTCPServerTemplate(prevCfgParams.TCPServerTemplate); restoreErr != nil {
+				klog.ErrorS(restoreErr, "Error restoring the previous TCPServer template")
+			}
+			return fmt.Errorf("Error executing TCPServer template: %v", err)
+		}
+	}
+
+	rerenderTCPServers := templateChanged || tcpServerConfigParamsChanged(prevCfgParams, cfgParams)
+	cgr.setConfigParams(cfgParams, rerenderTCPServers)
+
+	err := cgr.applyConfig(ctx, cfgParams, rerenderTCPServers)
+	if err != nil {
+		tracing.SetError(span, err)
+		if templateChanged {
+			if restoreErr := cgr.templateExecutor.UpdateTCPServerTemplate(prevCfgParams.TCPServerTemplate); restoreErr != nil {
+				klog.ErrorS(restoreErr, "Error restoring the previous TCPServer template")
+			}
+		}
+		cgr.setConfigParams(prevCfgParams, rerenderTCPServers)
+		return err
 	}
 
 	return nil
 }
 
-func (cgr *Configurer) addOrUpdateTCPServer(tcpServerEx *TCPServerEx) error {
+func (cgr *Configurer) getConfigParams() *ConfigParams {
+	cgr.cfgParamsLock.RLock()
+	defer cgr.cfgParamsLock.RUnlock()
 
-	cfg := generateNginxTCPServerCfg(tcpServerEx)
+	return cgr.cfgParams
+}
 
-	name := getFileNameForTCPServer(tcpServerEx.TCPServer)
-	nginxConfig, err := cgr.templateExecutor.ExecuteTCPServerConfigTemplate(cfg)
+// setConfigParams replaces the ConfigParams. If stale is true, the generation changes, so that the changes
+// rendered with the previous template or ConfigParams are rendered again before they are applied.
+func (cgr *Configurer) setConfigParams(cfgParams *ConfigParams, stale bool) {
+	cgr.cfgParamsLock.Lock()
+	cgr.cfgParams = cfgParams
+	cgr.cfgParamsLock.Unlock()
+
+	if stale {
+		atomic.AddInt32(&cgr.renderGeneration, 1)
+	}
+}
+
+func (cgr *Configurer) applyConfig(ctx context.Context, cfgParams *ConfigParams, rerenderTCPServers bool) error {
+	mainCfg := GenerateNginxMainConfig(cfgParams, cgr.isPlus)
+
+	mainCfgContent, err := cgr.templateExecutor.ExecuteMainConfigTemplate(mainCfg)
 	if err != nil {
-		return fmt.Errorf("Error generating TCPServer Config %v: %v", name, err)
+		return fmt.Errorf("Error generating NGINX main config: %v", err)
 	}
-	cgr.nginxManager.CreateConfig(name, nginxConfig)
 
-	cgr.tcpServersEx[name] = tcpServerEx
+	var configChanges []nginx.ConfigChange
+	if rerenderTCPServers {
+		cgr.tcpServersLock.RLock()
+		defer cgr.tcpServersLock.RUnlock()
+
+		for _, tcpServerEx := range cgr.tcpServersEx {
+			content, err := cgr.renderTCPServer(tcpServerEx)
+			if err != nil {
+				return err
+			}
+
+			configChanges = append(configChanges, nginx.ConfigChange{
+				Name:    getFileNameForTCPServer(tcpServerEx.TCPServer),
+				Content: content,
+			})
+		}
+	}
+
+	if err := cgr.nginxManager.ApplyMainConfig(ctx, mainCfgContent, configChanges); err != nil {
+		if _, isWriteErr := err.(*nginx.WriteError); isWriteErr {
+			return err
+		}
+		return fmt.Errorf("Error applying NGINX main config: %v", err)
+	}
 
 	return nil
 }
 
-// DeleteTCPServer deletes NGINX configuration for the TCPServer
-func (cgr *Configurer) DeleteTCPServer(key string) error {
-	name := getFileNameForTCPServerFromKey(key)
-	cgr.nginxManager.DeleteConfig(name)
+// GetTCPServerEx returns the TCPServerEx of the TCPServer with the key, as last applied to NGINX.
+func (cgr *Configurer) GetTCPServerEx(key string) (*TCPServerEx, bool) {
+	cgr.tcpServersLock.RLock()
+	defer cgr.tcpServersLock.RUnlock()
+
+	tcpServerEx, exists := cgr.tcpServersEx[key]
+	return tcpServerEx, exists
+}
 
-	delete(cgr.tcpServersEx, key)
+// GetTCPServersEx returns the TCPServerEx of every TCPServer, as last applied to NGINX, sorted by key.
+func (cgr *Configurer) GetTCPServersEx() []*TCPServerEx {
+	cgr.tcpServersLock.RLock()
+	defer cgr.tcpServersLock.RUnlock()
 
-	if err := cgr.nginxManager.Reload(); err != nil {
-		return fmt.Errorf("Error when removing TCPServer %v: %v", key, err)
+	var result []*TCPServerEx
+	for _, tcpServerEx := range cgr.tcpServersEx {
+		result = append(result, tcpServerEx)
 	}
 
-	return nil
+	sort.Slice(result, func(i, j int) bool {
+		return getKeyForTCPServer(result[i].TCPServer) < getKeyForTCPServer(result[j].TCPServer)
+	})
+
+	return result
+}
+
+// GetTCPServerConfig returns the content of the config file of the TCPServer with the key, as last written for NGINX.
+// Returns false if the TCPServer is not in NGINX.
+func (cgr *Configurer) GetTCPServerConfig(key string) ([]byte, bool, error) {
+	if _, exists := cgr.GetTCPServerEx(key); !exists {
+		return nil, false, nil
+	}
+
+	content, err := cgr.nginxManager.ReadConfig(getFileNameForTCPServerFromKey(key))
+	return content, true, err
+}
+
+// GetTCPServerZones returns the TCPServers in NGINX, by the name of the status zone of their server and the zone of their
+// upstream in NGINX Plus.
+func (cgr *Configurer) GetTCPServerZones() map[string]types.NamespacedName {
+	cgr.tcpServersLock.RLock()
+	defer cgr.tcpServersLock.RUnlock()
+
+	zones := make(map[string]types.NamespacedName, len(cgr.tcpServersEx))
+	for _, tcpServerEx := range cgr.tcpServersEx {
+		tcps := tcpServerEx.TCPServer
+		zones[getZoneNameForTCPServer(tcps)] = types.NamespacedName{Namespace: tcps.Namespace, Name: tcps.Name}
+	}
+
+	return zones
+}
+
+func getKeyForTCPServer(tcpServer *k8snginx_v1.TCPServer) string {
+	return fmt.Sprintf("%s/%s", tcpServer.Namespace, tcpServer.Name)
 }
 
 func getFileNameForTCPServer(tcpServer *k8snginx_v1.TCPServer) string {
@@ -0,0 +1,627 @@
+package configuration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	exporttrace "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/export/trace/tracetest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mohamed-gougam/kube-agent/internal/configuration/version1"
+	"github.com/mohamed-gougam/kube-agent/internal/nginx"
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+// countingManager counts the reloads and fails the test if two of them overlap.
+type countingManager struct {
+	*nginx.FakeManager
+	t        *testing.T
+	inReload int32
+	reloads  int32
+}
+
+func newCountingManager(t *testing.T) *countingManager {
+	return &countingManager{
+		FakeManager: nginx.NewFakeManager("/etc/nginx"),
+		t:           t,
+	}
+}
+
+func (cm *countingManager) ApplyConfigs(ctx context.Context, changes []nginx.ConfigChange) error {
+	if !atomic.CompareAndSwapInt32(&cm.inReload, 0, 1) {
+		cm.t.Error("ApplyConfigs() was called while another reload was in progress")
+	}
+	time.Sleep(time.Millisecond)
+	atomic.AddInt32(&cm.reloads, 1)
+	atomic.StoreInt32(&cm.inReload, 0)
+	return nil
+}
+
+func createTestConfigurer(t *testing.T, manager nginx.Manager, batchWindow time.Duration) *Configurer {
+	return createTestConfigurerWithPlus(t, manager, batchWindow, false)
+}
+
+func createTestConfigurerWithPlus(t *testing.T, manager nginx.Manager, batchWindow time.Duration, isPlus bool) *Configurer {
+	templateExecutor, err := version1.NewTemplateExecutor()
+	if err != nil {
+		t.Fatalf("NewTemplateExecutor() returned unexpected error: %v", err)
+	}
+
+	return NewConfigurer(manager, templateExecutor, NewDefaultConfigParams(""), batchWindow, isPlus)
+}
+
+func createTestTCPServerEx(namespace, name string, listenPort int) *TCPServerEx {
+	return &TCPServerEx{
+		TCPServer: &k8snginx_v1.TCPServer{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+			},
+			Spec: k8snginx_v1.TCPServerSpec{
+				ListenPort:  listenPort,
+				ServiceName: "svc",
+				ServicePort: 80,
+			},
+		},
+	}
+}
+
+func TestConfigurerKeepsEarliestEventTime(t *testing.T) {
+	cgr := createTestConfigurer(t, newCountingManager(t), 0)
+
+	eventTimes := make(chan time.Time, 1)
+	cgr.SetApplyHandler(func(key string, tcpServerEx *TCPServerEx, eventTime time.Time, err error) {
+		eventTimes <- eventTime
+	})
+
+	firstEvent := time.Now().Add(-time.Second)
+	if err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", "tcps", 8000), firstEvent); err != nil {
+		t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+	}
+	if err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", "tcps", 8001), time.Now()); err != nil {
+		t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go cgr.Run(stopCh)
+
+	select {
+	case eventTime := <-eventTimes:
+		if !eventTime.Equal(firstEvent) {
+			t.Errorf("ApplyHandler received the event time %v, expected the time of the first event %v", eventTime, firstEvent)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the result of the change")
+	}
+}
+
+func TestConfigurerBatchesChangesIntoSingleReload(t *testing.T) {
+	manager := newCountingManager(t)
+	cgr := createTestConfigurer(t, manager, 50*time.Millisecond)
+
+	results := make(chan error, 10)
+	cgr.SetApplyHandler(func(key string, tcpServerEx *TCPServerEx, eventTime time.Time, err error) {
+		results <- err
+	})
+
+	for i := 0; i < 9; i++ {
+		err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", fmt.Sprintf("tcps-%d", i), 8000+i), time.Now())
+		if err != nil {
+			t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+		}
+	}
+	cgr.DeleteTCPServer(context.Background(), "default/tcps-old", time.Now())
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go cgr.Run(stopCh)
+
+	for i := 0; i < 10; i++ {
+		select {
+		case err := <-results:
+			if err != nil {
+				t.Errorf("ApplyHandler received unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the result of change %v", i)
+		}
+	}
+
+	if reloads := atomic.LoadInt32(&manager.reloads); reloads != 1 {
+		t.Errorf("applying the changes reloaded NGINX %v times, expected 1", reloads)
+	}
+	if len(cgr.tcpServersEx) != 9 {
+		t.Errorf("Configurer has %v TCPServers, expected 9", len(cgr.tcpServersEx))
+	}
+}
+
+func TestConfigurerLinksBatchSpanToChangeSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	cgr := createTestConfigurer(t, newCountingManager(t), 0)
+
+	// the second change of tcps-a replaces the first one, which is applied by the same batch
+	for _, name := range []string{"tcps-a", "tcps-b", "tcps-a"} {
+		if err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", name, 8000), time.Now()); err != nil {
+			t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+		}
+	}
+	cgr.applyChanges(cgr.takePendingChanges())
+
+	changeSpans := make(map[trace.SpanID]bool)
+	var batchSpan *exporttrace.SpanData
+	for _, span := range exporter.GetSpans() {
+		switch span.Name {
+		case "Configurer.AddOrUpdateTCPServer":
+			changeSpans[span.SpanContext.SpanID] = true
+		case "Configurer.applyChanges":
+			batchSpan = span
+		}
+	}
+
+	if len(changeSpans) != 3 {
+		t.Fatalf("AddOrUpdateTCPServer() recorded %v spans, expected 3", len(changeSpans))
+	}
+	if batchSpan == nil {
+		t.Fatalf("applyChanges() recorded no span")
+	}
+	if len(batchSpan.Links) != 3 {
+		t.Fatalf("the span of applyChanges() has %v links, expected 3", len(batchSpan.Links))
+	}
+	for _, link := range batchSpan.Links {
+		if !changeSpans[link.SpanContext.SpanID] {
+			t.Errorf("the span of applyChanges() links to %v, expected a span of AddOrUpdateTCPServer()", link.SpanContext.SpanID)
+		}
+	}
+}
+
+func TestConfigurerConcurrentChanges(t *testing.T) {
+	manager := newCountingManager(t)
+	cgr := createTestConfigurer(t, manager, 0)
+
+	const workers = 4
+	const changesPerWorker = 50
+
+	var applied sync.WaitGroup
+	applied.Add(workers)
+	var lock sync.Mutex
+	lastApplied := make(map[string]int)
+	cgr.SetApplyHandler(func(key string, tcpServerEx *TCPServerEx, eventTime time.Time, err error) {
+		if err != nil {
+			t.Errorf("ApplyHandler received unexpected error for %v: %v", key, err)
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		port := tcpServerEx.TCPServer.Spec.ListenPort
+		if port < lastApplied[key] {
+			t.Errorf("change with port %v of %v was applied after a newer change with port %v", port, key, lastApplied[key])
+		}
+		lastApplied[key] = port
+		if port == changesPerWorker {
+			applied.Done()
+		}
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go cgr.Run(stopCh)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for i := 1; i <= changesPerWorker; i++ {
+				err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", name, i), time.Now())
+				if err != nil {
+					t.Errorf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+				}
+				cgr.GetTCPServerEx("default/" + name)
+			}
+		}(fmt.Sprintf("tcps-%d", w))
+	}
+	wg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		applied.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the last changes to be applied")
+	}
+
+	for w := 0; w < workers; w++ {
+		key := fmt.Sprintf("default/tcps-%d", w)
+		tcpServerEx, exists := cgr.GetTCPServerEx(key)
+		if !exists {
+			t.Errorf("GetTCPServerEx(%v) didn't find the TCPServer", key)
+			continue
+		}
+		if tcpServerEx.TCPServer.Spec.ListenPort != changesPerWorker {
+			t.Errorf("GetTCPServerEx(%v) returned port %v, expected the last change with port %v", key, tcpServerEx.TCPServer.Spec.ListenPort, changesPerWorker)
+		}
+	}
+}
+
+// rejectingManager fails the configuration test of the configs with a rejected name. The errors are reported in
+// reportedName if it is set, or else in the rejected config.
+type rejectingManager struct {
+	*nginx.FakeManager
+	rejected     map[string]bool
+	reportedName string
+	applied      []string
+}
+
+func (rm *rejectingManager) ApplyConfigs(ctx context.Context, changes []nginx.ConfigChange) error {
+	for _, change := range changes {
+		if rm.rejected[change.Name] {
+			name := change.Name
+			if rm.reportedName != "" {
+				name = rm.reportedName
+			}
+			return &nginx.ConfigTestError{
+				Names:  []string{name},
+				Output: fmt.Sprintf("duplicate listen in %v", name),
+			}
+		}
+	}
+
+	for _, change := range changes {
+		rm.applied = append(rm.applied, change.Name)
+	}
+	return nil
+}
+
+func TestConfigurerRejectsChangesFailingConfigTest(t *testing.T) {
+	tests := []struct {
+		reportedName string
+		msg          string
+	}{
+		{
+			reportedName: "",
+			msg:          "an error in the config of the change",
+		},
+		{
+			reportedName: "tcp/tcps_default_live",
+			msg:          "an error in the config of a TCPServer outside of the batch",
+		},
+	}
+
+	for _, test := range tests {
+		testRejectsChangesFailingConfigTest(t, test.reportedName, test.msg)
+	}
+}
+
+func testRejectsChangesFailingConfigTest(t *testing.T, reportedName string, msg string) {
+	manager := &rejectingManager{
+		FakeManager:  nginx.NewFakeManager("/etc/nginx"),
+		rejected:     map[string]bool{"tcp/tcps_default_bad": true},
+		reportedName: reportedName,
+	}
+	cgr := createTestConfigurer(t, manager, 0)
+
+	results := make(map[string]error)
+	cgr.SetApplyHandler(func(key string, tcpServerEx *TCPServerEx, eventTime time.Time, err error) {
+		results[key] = err
+	})
+
+	for _, name := range []string{"good", "bad", "other"} {
+		err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", name, 8000), time.Now())
+		if err != nil {
+			t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+		}
+	}
+
+	cgr.applyChanges(cgr.takePendingChanges())
+
+	if results["default/bad"] == nil {
+		t.Errorf("the change of default/bad was applied for the case of %s, expected it to be rejected", msg)
+	}
+	for _, key := range []string{"default/good", "default/other"} {
+		if err, reported := results[key]; !reported || err != nil {
+			t.Errorf("the change of %v wasn't applied for the case of %s: %v", key, msg, err)
+		}
+	}
+	if len(manager.applied) != 2 {
+		t.Errorf("applied configs %v for the case of %s, expected the 2 valid configs", manager.applied, msg)
+	}
+	if _, exists := cgr.GetTCPServerEx("default/bad"); exists {
+		t.Errorf("GetTCPServerEx(default/bad) found the rejected TCPServer for the case of %s", msg)
+	}
+}
+
+// plusManager records the upstream server updates done through the NGINX Plus API, and the configs written
+// without a reload.
+type plusManager struct {
+	countingManager
+	updatedServers map[string][]string
+	writes         [][]nginx.ConfigChange
+	writeErr       error
+}
+
+func (pm *plusManager) UpdateServersInPlus(upstream string, servers []string, config nginx.ServerConfig) error {
+	if len(pm.writes) == 0 {
+		pm.t.Errorf("the servers of %v were updated through the NGINX Plus API before the configs were tested", upstream)
+	}
+	pm.updatedServers[upstream] = servers
+	return nil
+}
+
+func (pm *plusManager) WriteConfigsWithoutReload(changes []nginx.ConfigChange) error {
+	if pm.writeErr != nil {
+		return pm.writeErr
+	}
+	pm.writes = append(pm.writes, changes)
+	return nil
+}
+
+func TestConfigurerAppliesEndpointsChangesInPlus(t *testing.T) {
+	manager := &plusManager{
+		countingManager: *newCountingManager(t),
+		updatedServers:  make(map[string][]string),
+	}
+	cgr := createTestConfigurerWithPlus(t, manager, 0, true)
+
+	apply := func(tcpServerEx *TCPServerEx) {
+		if err := cgr.AddOrUpdateTCPServer(context.Background(), tcpServerEx, time.Now()); err != nil {
+			t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+		}
+		cgr.applyChanges(cgr.takePendingChanges())
+	}
+
+	tcpServerEx := createTestTCPServerEx("default", "tea", 8000)
+	apply(tcpServerEx)
+
+	endpointsChange := createTestTCPServerEx("default", "tea", 8000)
+	endpointsChange.ServiceAddresses = []*net.TCPAddr{{IP: net.ParseIP("10.0.0.1"), Port: 80}}
+	apply(endpointsChange)
+
+	if reloads := atomic.LoadInt32(&manager.reloads); reloads != 1 {
+		t.Errorf("NGINX was reloaded %v times, expected the endpoints change not to reload it", reloads)
+	}
+	servers := manager.updatedServers["tcps_default_tea"]
+	if len(servers) != 1 || servers[0] != "10.0.0.1:80" {
+		t.Errorf("the servers of tcps_default_tea were updated to %v, expected [10.0.0.1:80]", servers)
+	}
+
+	specChange := createTestTCPServerEx("default", "tea", 9000)
+	apply(specChange)
+
+	if reloads := atomic.LoadInt32(&manager.reloads); reloads != 2 {
+		t.Errorf("NGINX was reloaded %v times, expected the spec change to reload it", reloads)
+	}
+}
+
+func TestConfigurerWritesEndpointsChangesInPlusOnce(t *testing.T) {
+	manager := &plusManager{
+		countingManager: *newCountingManager(t),
+		updatedServers:  make(map[string][]string),
+	}
+	cgr := createTestConfigurerWithPlus(t, manager, 0, true)
+
+	names := []string{"tea", "coffee"}
+	for _, name := range names {
+		if err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", name, 8000), time.Now()); err != nil {
+			t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+		}
+	}
+	cgr.applyChanges(cgr.takePendingChanges())
+
+	for _, name := range names {
+		endpointsChange := createTestTCPServerEx("default", name, 8000)
+		endpointsChange.ServiceAddresses = []*net.TCPAddr{{IP: net.ParseIP("10.0.0.1"), Port: 80}}
+		if err := cgr.AddOrUpdateTCPServer(context.Background(), endpointsChange, time.Now()); err != nil {
+			t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+		}
+	}
+	cgr.applyChanges(cgr.takePendingChanges())
+
+	if len(manager.writes) != 1 || len(manager.writes[0]) != 2 {
+		t.Errorf("the configs were written without a reload %v times, expected once for both endpoints changes", len(manager.writes))
+	}
+	if len(manager.updatedServers) != 2 {
+		t.Errorf("the servers of %v upstreams were updated through the NGINX Plus API, expected 2", len(manager.updatedServers))
+	}
+}
+
+func TestConfigurerReloadsEndpointsChangesFailingConfigTestInPlus(t *testing.T) {
+	manager := &plusManager{
+		countingManager: *newCountingManager(t),
+		updatedServers:  make(map[string][]string),
+	}
+	cgr := createTestConfigurerWithPlus(t, manager, 0, true)
+
+	if err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", "tea", 8000), time.Now()); err != nil {
+		t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+	}
+	cgr.applyChanges(cgr.takePendingChanges())
+
+	manager.writeErr = &nginx.ConfigTestError{Output: "unknown directive"}
+	endpointsChange := createTestTCPServerEx("default", "tea", 8000)
+	endpointsChange.ServiceAddresses = []*net.TCPAddr{{IP: net.ParseIP("10.0.0.1"), Port: 80}}
+	if err := cgr.AddOrUpdateTCPServer(context.Background(), endpointsChange, time.Now()); err != nil {
+		t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+	}
+	cgr.applyChanges(cgr.takePendingChanges())
+
+	if len(manager.updatedServers) != 0 {
+		t.Errorf("the servers %v were updated through the NGINX Plus API, expected no update after the failed config test", manager.updatedServers)
+	}
+	if reloads := atomic.LoadInt32(&manager.reloads); reloads != 2 {
+		t.Errorf("NGINX was reloaded %v times, expected the endpoints change to fall back to a reload", reloads)
+	}
+}
+
+func TestConfigurerUpdateConfigKeepsTemplateOnError(t *testing.T) {
+	cgr := createTestConfigurer(t, nginx.NewFakeManager("/etc/nginx"), 0)
+	tcpServerEx := createTestTCPServerEx("default", "tcps", 8000)
+	cgr.updateTCPServersEx([]*tcpServerChange{{key: "default/tcps", tcpServerEx: tcpServerEx}})
+
+	cfgParams := NewDefaultConfigParams("")
+	cfgParams.TCPServerTemplate = "# custom {{.Upstream.Name}}"
+	if err := cgr.UpdateConfig(cfgParams); err != nil {
+		t.Fatalf("UpdateConfig() returned unexpected error: %v", err)
+	}
+
+	invalidTemplates := []string{
+		"# {{.Upstream.Name",
+		"# {{.Missing}}",
+	}
+	for _, template := range invalidTemplates {
+		cfgParams.TCPServerTemplate = template
+		if err := cgr.UpdateConfig(cfgParams); err == nil {
+			t.Errorf("UpdateConfig() with the template %q returned no error", template)
+		}
+
+		content, err := cgr.renderTCPServer(tcpServerEx)
+		if err != nil {
+			t.Fatalf("renderTCPServer() returned unexpected error: %v", err)
+		}
+		if string(content) != "# custom tcps_default_tcps" {
+			t.Errorf("renderTCPServer() after the template %q returned %q, expected the previous template to be kept", template, content)
+		}
+	}
+}
+
+func TestConfigurerUpdateConfigChecksTemplateWithoutTCPServers(t *testing.T) {
+	cgr := createTestConfigurer(t, nginx.NewFakeManager("/etc/nginx"), 0)
+
+	cfgParams := NewDefaultConfigParams("")
+	cfgParams.TCPServerTemplate = "# {{.Missing}}"
+	if err := cgr.UpdateConfig(cfgParams); err == nil {
+		t.Errorf("UpdateConfig() with a template that fails to execute returned no error")
+	}
+
+	if _, err := cgr.renderTCPServer(createTestTCPServerEx("default", "tcps", 8000)); err != nil {
+		t.Errorf("renderTCPServer() returned unexpected error after the rejected template: %v", err)
+	}
+}
+
+// failingManager fails to apply the configs with err.
+type failingManager struct {
+	*nginx.FakeManager
+	err error
+}
+
+func (fm *failingManager) ApplyConfigs(ctx context.Context, changes []nginx.ConfigChange) error {
+	return fm.err
+}
+
+func TestConfigurerKeepsTCPServersOnFailedReload(t *testing.T) {
+	tests := []struct {
+		err error
+		msg string
+	}{
+		{
+			err: errors.New("reload failed"),
+			msg: "reload error",
+		},
+		{
+			err: &nginx.RollbackError{Err: errors.New("reload failed")},
+			msg: "rollback",
+		},
+	}
+
+	for _, test := range tests {
+		manager := &failingManager{FakeManager: nginx.NewFakeManager("/etc/nginx")}
+		cgr := createTestConfigurer(t, manager, 0)
+
+		var results []error
+		cgr.SetApplyHandler(func(key string, tcpServerEx *TCPServerEx, eventTime time.Time, err error) {
+			results = append(results, err)
+		})
+
+		if err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", "tcps", 8000), time.Now()); err != nil {
+			t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+		}
+		cgr.applyChanges(cgr.takePendingChanges())
+
+		manager.err = test.err
+		if err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", "tcps", 8001), time.Now()); err != nil {
+			t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+		}
+		cgr.applyChanges(cgr.takePendingChanges())
+
+		if len(results) != 2 || results[0] != nil || results[1] == nil {
+			t.Errorf("ApplyHandler received %v for the case of %s, expected a success and an error", results, test.msg)
+		}
+
+		tcpServerEx, exists := cgr.GetTCPServerEx("default/tcps")
+		if !exists || tcpServerEx.TCPServer.Spec.ListenPort != 8000 {
+			t.Errorf("GetTCPServerEx(default/tcps) returned %v for the case of %s, expected the TCPServer with port 8000", tcpServerEx, test.msg)
+		}
+	}
+}
+
+// rollingBackManager fails to reload NGINX, and rolls it back, with the configs with a failing name.
+type rollingBackManager struct {
+	*nginx.FakeManager
+	failing map[string]bool
+	applied []string
+}
+
+func (rm *rollingBackManager) ApplyConfigs(ctx context.Context, changes []nginx.ConfigChange) error {
+	for _, change := range changes {
+		if rm.failing[change.Name] {
+			return &nginx.RollbackError{Err: errors.New("bind() to 0.0.0.0:8000 failed")}
+		}
+	}
+
+	for _, change := range changes {
+		rm.applied = append(rm.applied, change.Name)
+	}
+	return nil
+}
+
+func TestConfigurerAppliesGoodChangesOfRolledBackBatch(t *testing.T) {
+	manager := &rollingBackManager{
+		FakeManager: nginx.NewFakeManager("/etc/nginx"),
+		failing:     map[string]bool{"tcp/tcps_default_bad": true},
+	}
+	cgr := createTestConfigurer(t, manager, 0)
+
+	results := make(map[string]error)
+	cgr.SetApplyHandler(func(key string, tcpServerEx *TCPServerEx, eventTime time.Time, err error) {
+		results[key] = err
+	})
+
+	for _, name := range []string{"bad", "good"} {
+		if err := cgr.AddOrUpdateTCPServer(context.Background(), createTestTCPServerEx("default", name, 8000), time.Now()); err != nil {
+			t.Fatalf("AddOrUpdateTCPServer() returned unexpected error: %v", err)
+		}
+	}
+	cgr.applyChanges(cgr.takePendingChanges())
+
+	if _, isRollbackErr := results["default/bad"].(*nginx.RollbackError); !isRollbackErr {
+		t.Errorf("ApplyHandler received %v for default/bad, expected a *nginx.RollbackError", results["default/bad"])
+	}
+	if err, reported := results["default/good"]; !reported || err != nil {
+		t.Errorf("the change of default/good wasn't applied: %v", err)
+	}
+	if len(manager.applied) != 1 || manager.applied[0] != "tcp/tcps_default_good" {
+		t.Errorf("applied configs %v, expected only tcp/tcps_default_good", manager.applied)
+	}
+	if _, exists := cgr.GetTCPServerEx("default/good"); !exists {
+		t.Error("GetTCPServerEx(default/good) didn't find the applied TCPServer")
+	}
+	if _, exists := cgr.GetTCPServerEx("default/bad"); exists {
+		t.Error("GetTCPServerEx(default/bad) found the TCPServer NGINX was rolled back from")
+	}
+}
@@ -3,8 +3,12 @@ package configuration
 import (
 	"fmt"
 	"net"
+	"strings"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/mohamed-gougam/kube-agent/internal/configuration/version1"
+	"github.com/mohamed-gougam/kube-agent/internal/nginx"
 	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
 )
 
@@ -14,6 +18,22 @@ type TCPServerEx struct {
 	ServiceAddresses []*net.TCPAddr
 }
 
+// sampleTCPServerEx is rendered to check a new TCPServer template before it is used. It sets every field of TCPServerConf.
+var sampleTCPServerEx = &TCPServerEx{
+	TCPServer: &k8snginx_v1.TCPServer{
+		ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "sample"},
+		Spec: k8snginx_v1.TCPServerSpec{
+			ListenPort:       5000,
+			ServiceName:      "sample",
+			ServicePort:      80,
+			ServerSnippets:   "# server snippet",
+			UpstreamSnippets: "# upstream snippet",
+			AccessLog:        &k8snginx_v1.AccessLog{Path: "/dev/stdout"},
+		},
+	},
+	ServiceAddresses: []*net.TCPAddr{{IP: net.ParseIP("10.0.0.1"), Port: 8080}},
+}
+
 // NewTCPServerEx returns a new TCPServerEx.
 func NewTCPServerEx(tcps *k8snginx_v1.TCPServer,
 	svcExternalIPs []string) (*TCPServerEx, error) {
@@ -39,14 +59,32 @@ func NewTCPServerEx(tcps *k8snginx_v1.TCPServer,
 	}, allErrors
 }
 
-func generateNginxTCPServerCfg(tcpServerEx *TCPServerEx) *version1.TCPServerConf {
+// upstreamZoneSize is the size of the shared memory zone of the upstreams in NGINX Plus.
+const upstreamZoneSize = "256k"
+
+// defaultPlusServerConfig matches the parameters of the upstream servers in the TCPServer template,
+// so that servers updated through the NGINX Plus API behave like the ones created by a reload.
+var defaultPlusServerConfig = nginx.ServerConfig{
+	MaxFails:    1,
+	FailTimeout: "10s",
+}
+
+func generateNginxTCPServerCfg(tcpServerEx *TCPServerEx, cfgParams *ConfigParams, isPlus bool) *version1.TCPServerConf {
 	// Very simple for now. Might be extended
 	result := &version1.TCPServerConf{
+		AccessLog:  generateAccessLog(tcpServerEx.TCPServer, cfgParams),
 		ListenPort: tcpServerEx.TCPServer.Spec.ListenPort,
 		Upstream: version1.Upstream{
-			Name:            getUpstreamNameForTCPServer(tcpServerEx.TCPServer),
-			UpstreamServers: []version1.UpstreamServer{},
+			Name:             getUpstreamNameForTCPServer(tcpServerEx.TCPServer),
+			UpstreamServers:  []version1.UpstreamServer{},
+			UpstreamSnippets: generateSnippets(tcpServerEx.TCPServer.Spec.UpstreamSnippets),
 		},
+		ServerSnippets: generateSnippets(tcpServerEx.TCPServer.Spec.ServerSnippets),
+	}
+
+	if isPlus {
+		result.StatusZone = getZoneNameForTCPServer(tcpServerEx.TCPServer)
+		result.Upstream.UpstreamZoneSize = upstreamZoneSize
 	}
 
 	if len(tcpServerEx.ServiceAddresses) > 0 {
@@ -63,6 +101,53 @@ func generateNginxTCPServerCfg(tcpServerEx *TCPServerEx) *version1.TCPServerConf
 	return result
 }
 
+// generateAccessLog generates the access log of the TCPServer. The log format of the TCPServer is the stream log format
+// with the namespace and the name of the TCPServer. The TCPServer can disable the access log or override its destination.
+func generateAccessLog(tcpServer *k8snginx_v1.TCPServer, cfgParams *ConfigParams) version1.AccessLog {
+	destination := cfgParams.StreamAccessLog
+	if tcpServer.Spec.AccessLog != nil {
+		if tcpServer.Spec.AccessLog.Disable {
+			destination = ""
+		} else if tcpServer.Spec.AccessLog.Path != "" {
+			destination = tcpServer.Spec.AccessLog.Path
+		}
+	}
+
+	if destination == "off" {
+		destination = ""
+	}
+
+	return version1.AccessLog{
+		FormatName:  getUpstreamNameForTCPServer(tcpServer),
+		Format:      generateStreamLogFormat(cfgParams.StreamLogFormat, tcpServer.Namespace, tcpServer.Name),
+		Escaping:    cfgParams.StreamLogFormatEscaping,
+		Destination: destination,
+	}
+}
+
+// generateSnippets splits the snippets into lines. The snippets are validated before, so they are only set
+// if snippets are enabled.
+func generateSnippets(snippets string) []string {
+	if snippets == "" {
+		return nil
+	}
+	return strings.Split(snippets, "\n")
+}
+
+func getUpstreamServerAddresses(upstream version1.Upstream) []string {
+	var addresses []string
+	for _, server := range upstream.UpstreamServers {
+		addresses = append(addresses, server.Address.String())
+	}
+	return addresses
+}
+
 func getUpstreamNameForTCPServer(tcpServer *k8snginx_v1.TCPServer) string {
 	return fmt.Sprintf("tcps_%s_%s", tcpServer.Namespace, tcpServer.Name)
 }
+
+// getZoneNameForTCPServer returns the name of the status zone of the server of the TCPServer in NGINX Plus.
+// It is the name of the zone of the upstream as well.
+func getZoneNameForTCPServer(tcpServer *k8snginx_v1.TCPServer) string {
+	return getUpstreamNameForTCPServer(tcpServer)
+}
@@ -0,0 +1,63 @@
+package configuration
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mohamed-gougam/kube-agent/internal/configuration/version1"
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+func TestGenerateAccessLog(t *testing.T) {
+	cfgParams := NewDefaultConfigParams("")
+	cfgParams.StreamLogFormat = "$remote_addr $tcpserver_namespace/$tcpserver_name"
+
+	tests := []struct {
+		accessLog       *k8snginx_v1.AccessLog
+		streamAccessLog string
+		expected        string
+		msg             string
+	}{
+		{
+			accessLog:       nil,
+			streamAccessLog: "/dev/stdout",
+			expected:        "/dev/stdout",
+			msg:             "the destination of the agent",
+		},
+		{
+			accessLog:       nil,
+			streamAccessLog: "off",
+			expected:        "",
+			msg:             "the access log disabled by the agent",
+		},
+		{
+			accessLog:       &k8snginx_v1.AccessLog{Path: "syslog:server=10.0.0.1"},
+			streamAccessLog: "off",
+			expected:        "syslog:server=10.0.0.1",
+			msg:             "the destination of the TCPServer",
+		},
+		{
+			accessLog:       &k8snginx_v1.AccessLog{Disable: true, Path: "/dev/stdout"},
+			streamAccessLog: "/dev/stdout",
+			expected:        "",
+			msg:             "the access log disabled by the TCPServer",
+		},
+	}
+
+	for _, test := range tests {
+		tcpServer := createTestTCPServerEx("default", "coffee", 8000).TCPServer
+		tcpServer.Spec.AccessLog = test.accessLog
+		cfgParams.StreamAccessLog = test.streamAccessLog
+
+		expected := version1.AccessLog{
+			FormatName:  "tcps_default_coffee",
+			Format:      "$remote_addr default/coffee",
+			Destination: test.expected,
+		}
+
+		result := generateAccessLog(tcpServer, cfgParams)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("generateAccessLog() returned %+v, expected %+v for the case of %s", result, expected, test.msg)
+		}
+	}
+}
@@ -4,23 +4,53 @@ import (
 	"net"
 )
 
+// MainConfig describes the main NGINX configuration file.
+type MainConfig struct {
+	NginxPlus               bool
+	StubStatusOnUnixSocket  bool
+	WorkerProcesses         string
+	WorkerConnections       string
+	WorkerRlimitNofile      string
+	WorkerShutdownTimeout   string
+	ErrorLogLevel           string
+	StreamLogFormat         string
+	StreamLogFormatEscaping string
+	StreamAccessLog         string
+	ResolverAddresses       []string
+	ResolverValid           string
+	ResolverTimeout         string
+}
+
 // TCPServerConf describes an NGINX TCPServer
 type TCPServerConf struct {
 	ListenPort int
-	Upstream   Upstream
+	// StatusZone is the zone of the statistics of the server in NGINX Plus.
+	StatusZone     string
+	Upstream       Upstream
+	ServerSnippets []string
+	AccessLog      AccessLog
+}
+
+// AccessLog describes the access log of a TCPServer. The access log is disabled if Destination is empty.
+type AccessLog struct {
+	FormatName  string
+	Format      string
+	Escaping    string
+	Destination string
 }
 
 // Upstream describes an NGINX upstream.
 type Upstream struct {
-	Name            string
-	UpstreamServers []UpstreamServer
+	Name             string
+	UpstreamServers  []UpstreamServer
+	UpstreamZoneSize string
+	UpstreamSnippets []string
 	// Additional attributes might be added here.
 	/*
 		StickyCookie     string
 		LBMethod         string
 		Queue            int64
 		QueueTimeout     int64
-		UpstreamZoneSize string
 	*/
 }
 
@@ -2,30 +2,68 @@ package version1
 
 import (
 	"bytes"
-	"path"
+	"sync"
 	"text/template"
 )
 
 // TemplateExecutor executes NGINX configuration templates.
 type TemplateExecutor struct {
+	mainTemplate      *template.Template
+	tcpServerLock     sync.RWMutex
 	tcpServerTemplate *template.Template
 }
 
-// NewTemplateExecutor creates a TemplateExecutor.
-func NewTemplateExecutor(tcpsTemplatePath string) (*TemplateExecutor, error) {
-	// template name must be the base name of the template file https://golang.org/pkg/text/template/#Template.ParseFiles
-	tcpServerTemplate, err := template.New(path.Base(tcpsTemplatePath)).ParseFiles(tcpsTemplatePath)
+// NewTemplateExecutor creates a TemplateExecutor with the default templates.
+func NewTemplateExecutor() (*TemplateExecutor, error) {
+	mainTemplate, err := template.New("nginx.tmpl").Parse(mainTemplateString)
+	if err != nil {
+		return nil, err
+	}
+
+	tcpServerTemplate, err := template.New("nginx.tcpserver.tmpl").Parse(tcpServerTemplateString)
 	if err != nil {
 		return nil, err
 	}
 
 	return &TemplateExecutor{
+		mainTemplate:      mainTemplate,
 		tcpServerTemplate: tcpServerTemplate,
 	}, nil
 }
 
-// ExecuteTCPServerConfigTemplate generates the content of the main NGINX configuration file.
+// UpdateTCPServerTemplate parses templateString and uses it as the TCPServer template. An empty templateString restores
+// the default template. If the template fails to parse, the current template is kept.
+func (te *TemplateExecutor) UpdateTCPServerTemplate(templateString string) error {
+	if templateString == "" {
+		templateString = tcpServerTemplateString
+	}
+
+	newTemplate, err := template.New("nginx.tcpserver.tmpl").Parse(templateString)
+	if err != nil {
+		return err
+	}
+
+	te.tcpServerLock.Lock()
+	defer te.tcpServerLock.Unlock()
+
+	te.tcpServerTemplate = newTemplate
+
+	return nil
+}
+
+// ExecuteMainConfigTemplate generates the content of the main NGINX configuration file.
+func (te *TemplateExecutor) ExecuteMainConfigTemplate(cfg *MainConfig) ([]byte, error) {
+	var configBuffer bytes.Buffer
+	err := te.mainTemplate.Execute(&configBuffer, cfg)
+
+	return configBuffer.Bytes(), err
+}
+
+// ExecuteTCPServerConfigTemplate generates the content of a TCPServer NGINX configuration file.
 func (te *TemplateExecutor) ExecuteTCPServerConfigTemplate(cfg *TCPServerConf) ([]byte, error) {
+	te.tcpServerLock.RLock()
+	defer te.tcpServerLock.RUnlock()
+
 	var configBuffer bytes.Buffer
 	err := te.tcpServerTemplate.Execute(&configBuffer, cfg)
 
@@ -0,0 +1,122 @@
+package version1
+
+// mainTemplateString is the template of the main NGINX configuration file.
+const mainTemplateString = `
+user  nginx;
+worker_processes  {{.WorkerProcesses}};
+{{if .WorkerRlimitNofile}}worker_rlimit_nofile {{.WorkerRlimitNofile}};{{end}}
+daemon off;
+
+error_log  /var/log/nginx/error.log {{.ErrorLogLevel}};
+pid        /var/run/nginx.pid;
+
+{{if .WorkerShutdownTimeout}}worker_shutdown_timeout {{.WorkerShutdownTimeout}};{{end}}
+
+
+events {
+    worker_connections  {{.WorkerConnections}};
+}
+
+
+# includes are relative to this file, so that a copy of the config can be tested with nginx -t.
+http {
+    include       mime.types;
+    default_type  application/octet-stream;
+
+    log_format  main  '$remote_addr - $remote_user [$time_local] "$request" '
+                     '$status $body_bytes_sent "$http_referer" '
+                      '"$http_user_agent" "$http_x_forwarded_for"';
+
+    access_log  /var/log/nginx/access.log  main;
+
+    sendfile        on;
+    #tcp_nopush     on;
+
+    keepalive_timeout  65;
+
+    #gzip  on;
+
+    include conf.d/*.conf;
+
+    {{if .NginxPlus}}
+    server {
+        listen unix:/var/lib/nginx/nginx-plus-api.sock;
+        access_log off;
+
+        location /api {
+            api write=on;
+        }
+
+        # used by the agent to make sure the API talks to the workers that run the latest config version.
+        location /configVersionCheck {
+            if ($config_version_mismatch) {
+                return 503;
+            }
+            return 200;
+        }
+    }
+    {{end}}
+
+    {{if .StubStatusOnUnixSocket}}
+    # used by the agent to expose the Prometheus metrics of NGINX.
+    server {
+        listen unix:/var/lib/nginx/nginx-status.sock;
+        access_log off;
+
+        location /stub_status {
+            stub_status;
+        }
+    }
+    {{end}}
+}
+
+stream {
+    log_format stream-main{{if .StreamLogFormatEscaping}} escape={{.StreamLogFormatEscaping}}{{end}} '{{.StreamLogFormat}}';
+
+    {{if and .StreamAccessLog (ne .StreamAccessLog "off")}}
+    access_log {{.StreamAccessLog}} stream-main;
+    {{else}}
+    access_log off;
+    {{end}}
+
+    {{if .ResolverAddresses}}
+    resolver {{range $address := .ResolverAddresses}}{{$address}} {{end}}{{if .ResolverValid}}valid={{.ResolverValid}}{{end}};
+    {{if .ResolverTimeout}}resolver_timeout {{.ResolverTimeout}};{{end}}
+    {{end}}
+
+    include conf.d/tcp/*.conf;
+
+    server {
+        listen 37;
+        return "$time_iso8601\n";
+    }
+}`
+
+// tcpServerTemplateString is the default template of the configuration file of a TCPServer.
+const tcpServerTemplateString = `{{if .AccessLog.Destination}}
+log_format {{.AccessLog.FormatName}}{{if .AccessLog.Escaping}} escape={{.AccessLog.Escaping}}{{end}} '{{.AccessLog.Format}}';
+{{end}}
+
+upstream {{.Upstream.Name}} {
+    {{if .Upstream.UpstreamZoneSize}}zone {{.Upstream.Name}} {{.Upstream.UpstreamZoneSize}};{{end}}
+    {{range $server := .Upstream.UpstreamServers}}
+    server {{$server.Address.IP}}:{{$server.Address.Port}};
+    {{end}}
+    {{range $value := .Upstream.UpstreamSnippets}}
+    {{$value}}{{end}}
+}
+
+server {
+    listen {{.ListenPort}};
+    proxy_pass {{.Upstream.Name}};
+    {{if .StatusZone}}status_zone {{.StatusZone}};{{end}}
+
+    {{if .AccessLog.Destination}}
+    access_log {{.AccessLog.Destination}} {{.AccessLog.FormatName}};
+    {{else}}
+    access_log off;
+    {{end}}
+    {{range $value := .ServerSnippets}}
+    {{$value}}{{end}}
+}
+`
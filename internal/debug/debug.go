@@ -0,0 +1,172 @@
+package debug
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"k8s.io/klog/v2"
+
+	"github.com/mohamed-gougam/kube-agent/internal/configuration"
+	"github.com/mohamed-gougam/kube-agent/internal/k8s"
+	"github.com/mohamed-gougam/kube-agent/internal/nginx"
+)
+
+const (
+	// tcpServersEndpoint is the path where the TCPServers in NGINX and their upstream servers are exposed
+	tcpServersEndpoint = "/debug/tcpservers"
+	// configEndpoint is the path where the NGINX config files of the TCPServers are exposed
+	configEndpoint = "/debug/config"
+	// endpointsEndpoint is the path where the reasons the endpoints of the services are upstream servers, or not, are exposed
+	endpointsEndpoint = "/debug/endpoints"
+	// configVersionEndpoint is the path where the config versions of NGINX are exposed
+	configVersionEndpoint = "/debug/configversion"
+)
+
+// tcpServerQueryParam selects a single TCPServer, as namespace/name.
+const tcpServerQueryParam = "tcpserver"
+
+type tcpServerInfo struct {
+	Key         string   `json:"key"`
+	ListenPort  int      `json:"listenPort"`
+	Service     string   `json:"service"`
+	ServicePort int      `json:"servicePort"`
+	Addresses   []string `json:"addresses"`
+}
+
+type configVersionInfo struct {
+	Written int    `json:"written"`
+	Running int    `json:"running"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Configurer is the part of the configuration.Configurer exposed by the Server.
+type Configurer interface {
+	GetTCPServersEx() []*configuration.TCPServerEx
+	GetTCPServerConfig(key string) ([]byte, bool, error)
+}
+
+// Controller is the part of the k8s.Controller exposed by the Server.
+type Controller interface {
+	GetEndpointsReports() map[string]*k8s.EndpointsReport
+}
+
+// Server exposes the internal state of the agent over http, to troubleshoot the TCPServers.
+type Server struct {
+	configurer   Configurer
+	controller   Controller
+	nginxManager nginx.Manager
+}
+
+// NewServer creates a new Server.
+func NewServer(configurer Configurer, controller Controller, nginxManager nginx.Manager) *Server {
+	return &Server{
+		configurer:   configurer,
+		controller:   controller,
+		nginxManager: nginxManager,
+	}
+}
+
+func (s *Server) handleTCPServers(w http.ResponseWriter, r *http.Request) {
+	tcpServers := []tcpServerInfo{}
+	for _, tcpServerEx := range s.configurer.GetTCPServersEx() {
+		tcps := tcpServerEx.TCPServer
+		addresses := []string{}
+		for _, address := range tcpServerEx.ServiceAddresses {
+			addresses = append(addresses, address.String())
+		}
+
+		tcpServers = append(tcpServers, tcpServerInfo{
+			Key:         fmt.Sprintf("%s/%s", tcps.Namespace, tcps.Name),
+			ListenPort:  tcps.Spec.ListenPort,
+			Service:     tcps.Spec.ServiceName,
+			ServicePort: tcps.Spec.ServicePort,
+			Addresses:   addresses,
+		})
+	}
+
+	s.writeJSON(w, tcpServersEndpoint, tcpServers)
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get(tcpServerQueryParam)
+	if key == "" {
+		http.Error(w, fmt.Sprintf("the %v query parameter is required, as namespace/name", tcpServerQueryParam), http.StatusBadRequest)
+		return
+	}
+
+	content, exists, err := s.configurer.GetTCPServerConfig(key)
+	if !exists {
+		http.Error(w, fmt.Sprintf("TCPServer %v is not in NGINX", key), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading the config of TCPServer %v: %v", key, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	s.write(w, configEndpoint, content)
+}
+
+func (s *Server) handleEndpoints(w http.ResponseWriter, r *http.Request) {
+	reports := s.controller.GetEndpointsReports()
+
+	key := r.URL.Query().Get(tcpServerQueryParam)
+	if key == "" {
+		s.writeJSON(w, endpointsEndpoint, reports)
+		return
+	}
+
+	report, exists := reports[key]
+	if !exists {
+		http.Error(w, fmt.Sprintf("TCPServer %v is not in NGINX", key), http.StatusNotFound)
+		return
+	}
+	s.writeJSON(w, endpointsEndpoint, report)
+}
+
+func (s *Server) handleConfigVersion(w http.ResponseWriter, r *http.Request) {
+	var info configVersionInfo
+	var err error
+
+	info.Written, info.Running, err = s.nginxManager.GetConfigVersions()
+	if err != nil {
+		info.Error = err.Error()
+	}
+
+	s.writeJSON(w, configVersionEndpoint, info)
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, endpoint string, value interface{}) {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error encoding the response: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.write(w, endpoint, append(content, '\n'))
+}
+
+func (s *Server) write(w http.ResponseWriter, endpoint string, content []byte) {
+	if _, err := w.Write(content); err != nil {
+		klog.ErrorS(err, "Error while sending a response", "path", endpoint)
+	}
+}
+
+// Run runs an http server to expose the internal state of the agent. The server only listens on the loopback
+// interface, the endpoints are meant to be queried from inside the Pod, for example with kubectl exec or port-forward.
+func (s *Server) Run(port int) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(tcpServersEndpoint, s.handleTCPServers)
+	mux.HandleFunc(configEndpoint, s.handleConfig)
+	mux.HandleFunc(endpointsEndpoint, s.handleEndpoints)
+	mux.HandleFunc(configVersionEndpoint, s.handleConfigVersion)
+
+	address := net.JoinHostPort("127.0.0.1", fmt.Sprint(port))
+	klog.InfoS("Starting debug listener", "address", address,
+		"paths", []string{tcpServersEndpoint, configEndpoint, endpointsEndpoint, configVersionEndpoint})
+	klog.Fatal("Error in debug listener server: ", http.ListenAndServe(address, mux))
+}
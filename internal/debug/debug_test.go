@@ -0,0 +1,205 @@
+package debug
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mohamed-gougam/kube-agent/internal/configuration"
+	"github.com/mohamed-gougam/kube-agent/internal/k8s"
+	"github.com/mohamed-gougam/kube-agent/internal/nginx"
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+type fakeConfigurer struct {
+	tcpServersEx []*configuration.TCPServerEx
+	configs      map[string][]byte
+	readErr      error
+}
+
+func (fc *fakeConfigurer) GetTCPServersEx() []*configuration.TCPServerEx {
+	return fc.tcpServersEx
+}
+
+func (fc *fakeConfigurer) GetTCPServerConfig(key string) ([]byte, bool, error) {
+	content, exists := fc.configs[key]
+	if !exists {
+		return nil, false, nil
+	}
+	return content, true, fc.readErr
+}
+
+type fakeController struct {
+	reports map[string]*k8s.EndpointsReport
+}
+
+func (fc *fakeController) GetEndpointsReports() map[string]*k8s.EndpointsReport {
+	return fc.reports
+}
+
+type configVersionsManager struct {
+	*nginx.FakeManager
+	written int
+	running int
+	err     error
+}
+
+func (cm *configVersionsManager) GetConfigVersions() (int, int, error) {
+	return cm.written, cm.running, cm.err
+}
+
+func createTestServer() *Server {
+	configurer := &fakeConfigurer{
+		tcpServersEx: []*configuration.TCPServerEx{
+			{
+				TCPServer: &k8snginx_v1.TCPServer{
+					ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "tcps"},
+					Spec:       k8snginx_v1.TCPServerSpec{ListenPort: 5000, ServiceName: "svc", ServicePort: 80},
+				},
+				ServiceAddresses: []*net.TCPAddr{{IP: net.ParseIP("10.0.0.1"), Port: 8080}},
+			},
+		},
+		configs: map[string][]byte{"default/tcps": []byte("server {\n    listen 5000;\n}\n")},
+	}
+	controller := &fakeController{
+		reports: map[string]*k8s.EndpointsReport{
+			"default/tcps": {Service: "svc", ServicePort: 80, TargetPort: 8080},
+		},
+	}
+	manager := &configVersionsManager{FakeManager: nginx.NewFakeManager("/etc/nginx"), written: 2, running: 1}
+
+	return NewServer(configurer, controller, manager)
+}
+
+func TestHandleTCPServers(t *testing.T) {
+	s := createTestServer()
+
+	w := httptest.NewRecorder()
+	s.handleTCPServers(w, httptest.NewRequest(http.MethodGet, tcpServersEndpoint, nil))
+
+	var tcpServers []tcpServerInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &tcpServers); err != nil {
+		t.Fatalf("handleTCPServers() returned invalid JSON %v: %v", w.Body.String(), err)
+	}
+
+	expected := []tcpServerInfo{
+		{Key: "default/tcps", ListenPort: 5000, Service: "svc", ServicePort: 80, Addresses: []string{"10.0.0.1:8080"}},
+	}
+	if !reflect.DeepEqual(tcpServers, expected) {
+		t.Errorf("handleTCPServers() returned %+v, expected %+v", tcpServers, expected)
+	}
+}
+
+func TestHandleConfig(t *testing.T) {
+	tests := []struct {
+		target   string
+		readErr  error
+		expected int
+		content  string
+		msg      string
+	}{
+		{
+			target:   configEndpoint + "?tcpserver=default/tcps",
+			expected: http.StatusOK,
+			content:  "server {\n    listen 5000;\n}\n",
+			msg:      "TCPServer in NGINX",
+		},
+		{
+			target:   configEndpoint,
+			expected: http.StatusBadRequest,
+			msg:      "no tcpserver query parameter",
+		},
+		{
+			target:   configEndpoint + "?tcpserver=default/other",
+			expected: http.StatusNotFound,
+			msg:      "TCPServer not in NGINX",
+		},
+		{
+			target:   configEndpoint + "?tcpserver=default/tcps",
+			readErr:  errors.New("read failed"),
+			expected: http.StatusInternalServerError,
+			msg:      "config file that can't be read",
+		},
+	}
+
+	for _, test := range tests {
+		s := createTestServer()
+		s.configurer.(*fakeConfigurer).readErr = test.readErr
+
+		w := httptest.NewRecorder()
+		s.handleConfig(w, httptest.NewRequest(http.MethodGet, test.target, nil))
+
+		if w.Code != test.expected {
+			t.Errorf("handleConfig() returned the status %v for the case of %s, expected %v", w.Code, test.msg, test.expected)
+		}
+		if test.content != "" && w.Body.String() != test.content {
+			t.Errorf("handleConfig() returned %q for the case of %s, expected %q", w.Body.String(), test.msg, test.content)
+		}
+	}
+}
+
+func TestHandleEndpoints(t *testing.T) {
+	tests := []struct {
+		target   string
+		expected int
+		content  string
+		msg      string
+	}{
+		{
+			target:   endpointsEndpoint,
+			expected: http.StatusOK,
+			content:  `"default/tcps"`,
+			msg:      "all TCPServers",
+		},
+		{
+			target:   endpointsEndpoint + "?tcpserver=default/tcps",
+			expected: http.StatusOK,
+			content:  `"targetPort": 8080`,
+			msg:      "a TCPServer in NGINX",
+		},
+		{
+			target:   endpointsEndpoint + "?tcpserver=default/other",
+			expected: http.StatusNotFound,
+			msg:      "a TCPServer not in NGINX",
+		},
+	}
+
+	for _, test := range tests {
+		s := createTestServer()
+
+		w := httptest.NewRecorder()
+		s.handleEndpoints(w, httptest.NewRequest(http.MethodGet, test.target, nil))
+
+		if w.Code != test.expected {
+			t.Errorf("handleEndpoints() returned the status %v for the case of %s, expected %v", w.Code, test.msg, test.expected)
+		}
+		if !strings.Contains(w.Body.String(), test.content) {
+			t.Errorf("handleEndpoints() returned %v for the case of %s, expected it to contain %v", w.Body.String(), test.msg, test.content)
+		}
+	}
+}
+
+func TestHandleConfigVersion(t *testing.T) {
+	s := createTestServer()
+	s.nginxManager.(*configVersionsManager).err = errors.New("nginx doesn't answer")
+
+	w := httptest.NewRecorder()
+	s.handleConfigVersion(w, httptest.NewRequest(http.MethodGet, configVersionEndpoint, nil))
+
+	var info configVersionInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("handleConfigVersion() returned invalid JSON %v: %v", w.Body.String(), err)
+	}
+
+	expected := configVersionInfo{Written: 2, Running: 1, Error: "nginx doesn't answer"}
+	if info != expected {
+		t.Errorf("handleConfigVersion() returned %+v, expected %+v", info, expected)
+	}
+}
@@ -0,0 +1,112 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"k8s.io/klog/v2"
+)
+
+// readyEndpoint is the path where the readiness of the agent is exposed
+const readyEndpoint = "/readyz"
+
+// healthEndpoint is the path where the liveness of the agent is exposed
+const healthEndpoint = "/healthz"
+
+// Check returns an error if the agent is not healthy, or not ready.
+type Check func() error
+
+// Server exposes the liveness and the readiness of the agent over http.
+type Server struct {
+	ready       int32
+	healthCheck Check
+	// readyCheck holds a Check, set once the agent has started.
+	readyCheck atomic.Value
+}
+
+// errStarting is returned by the readiness check until the agent has started.
+var errStarting = errors.New("the agent is starting")
+
+// NewServer creates a new Server. healthCheck is the check of /healthz.
+// The agent is reported as ready while readyCheck passes, until SetReady(false) is called on shutdown.
+// If readyCheck is nil, the agent is not ready until SetReadyCheck is called.
+func NewServer(healthCheck Check, readyCheck Check) *Server {
+	s := &Server{
+		ready:       1,
+		healthCheck: healthCheck,
+	}
+	if readyCheck != nil {
+		s.SetReadyCheck(readyCheck)
+	}
+	return s
+}
+
+// SetReadyCheck sets the check of /readyz. It lets the health server run before the components the readiness
+// depends on are created.
+func (s *Server) SetReadyCheck(readyCheck Check) {
+	s.readyCheck.Store(readyCheck)
+}
+
+// SetReady sets the readiness of the agent.
+func (s *Server) SetReady(ready bool) {
+	var value int32
+	if ready {
+		value = 1
+	}
+	atomic.StoreInt32(&s.ready, value)
+}
+
+// IsReady returns the readiness of the agent.
+func (s *Server) IsReady() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !s.IsReady() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	readyCheck, _ := s.readyCheck.Load().(Check)
+	if readyCheck == nil {
+		readyCheck = func() error { return errStarting }
+	}
+
+	if err := readyCheck(); err != nil {
+		klog.V(3).InfoS("The agent is not ready", "reason", err.Error())
+		http.Error(w, fmt.Sprintf("not ready: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	s.writeOK(w, readyEndpoint)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if err := s.healthCheck(); err != nil {
+		klog.ErrorS(err, "The agent is not healthy")
+		http.Error(w, fmt.Sprintf("not healthy: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	s.writeOK(w, healthEndpoint)
+}
+
+func (s *Server) writeOK(w http.ResponseWriter, endpoint string) {
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		klog.ErrorS(err, "Error while sending a response", "path", endpoint)
+	}
+}
+
+// Run runs an http server to expose the liveness and the readiness of the agent
+func (s *Server) Run(port int) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(readyEndpoint, s.handleReady)
+	mux.HandleFunc(healthEndpoint, s.handleHealth)
+
+	address := fmt.Sprintf(":%v", port)
+	klog.InfoS("Starting health listener", "address", address, "paths", []string{healthEndpoint, readyEndpoint})
+	klog.Fatal("Error in health listener server: ", http.ListenAndServe(address, mux))
+}
@@ -0,0 +1,106 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func passingCheck() error {
+	return nil
+}
+
+func failingCheck() error {
+	return errors.New("check failed")
+}
+
+func TestHandleReady(t *testing.T) {
+	tests := []struct {
+		ready      bool
+		readyCheck Check
+		expected   int
+		msg        string
+	}{
+		{
+			ready:      true,
+			readyCheck: passingCheck,
+			expected:   http.StatusOK,
+			msg:        "ready",
+		},
+		{
+			ready:      false,
+			readyCheck: passingCheck,
+			expected:   http.StatusServiceUnavailable,
+			msg:        "not ready",
+		},
+		{
+			ready:      true,
+			readyCheck: failingCheck,
+			expected:   http.StatusServiceUnavailable,
+			msg:        "failing readyCheck",
+		},
+	}
+
+	for _, test := range tests {
+		s := NewServer(passingCheck, test.readyCheck)
+		if !test.ready {
+			s.SetReady(false)
+		}
+
+		w := httptest.NewRecorder()
+		s.handleReady(w, httptest.NewRequest(http.MethodGet, readyEndpoint, nil))
+
+		if w.Code != test.expected {
+			t.Errorf("handleReady() returned the status %v for the case of %s, expected %v", w.Code, test.msg, test.expected)
+		}
+	}
+}
+
+func TestHandleHealth(t *testing.T) {
+	tests := []struct {
+		healthCheck Check
+		expected    int
+		msg         string
+	}{
+		{
+			healthCheck: passingCheck,
+			expected:    http.StatusOK,
+			msg:         "healthy",
+		},
+		{
+			healthCheck: failingCheck,
+			expected:    http.StatusServiceUnavailable,
+			msg:         "failing healthCheck",
+		},
+	}
+
+	for _, test := range tests {
+		s := NewServer(test.healthCheck, passingCheck)
+
+		w := httptest.NewRecorder()
+		s.handleHealth(w, httptest.NewRequest(http.MethodGet, healthEndpoint, nil))
+
+		if w.Code != test.expected {
+			t.Errorf("handleHealth() returned the status %v for the case of %s, expected %v", w.Code, test.msg, test.expected)
+		}
+	}
+}
+
+func TestHandleReadyBeforeSetReadyCheck(t *testing.T) {
+	s := NewServer(passingCheck, nil)
+
+	w := httptest.NewRecorder()
+	s.handleReady(w, httptest.NewRequest(http.MethodGet, readyEndpoint, nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("handleReady() returned the status %v before SetReadyCheck(), expected %v", w.Code, http.StatusServiceUnavailable)
+	}
+
+	s.SetReadyCheck(passingCheck)
+
+	w = httptest.NewRecorder()
+	s.handleReady(w, httptest.NewRequest(http.MethodGet, readyEndpoint, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("handleReady() returned the status %v after SetReadyCheck(), expected %v", w.Code, http.StatusOK)
+	}
+}
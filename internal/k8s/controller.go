@@ -1,15 +1,17 @@
 package k8s
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"sync"
 	"time"
 
-	"github.com/golang/glog"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	coreinformers "k8s.io/client-go/informers/core/v1"
@@ -20,8 +22,12 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
 
 	"github.com/mohamed-gougam/kube-agent/internal/configuration"
+	"github.com/mohamed-gougam/kube-agent/internal/metrics/collectors"
+	"github.com/mohamed-gougam/kube-agent/internal/nginx"
+	"github.com/mohamed-gougam/kube-agent/internal/tracing"
 	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
 	"github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/validation"
 	clientset "github.com/mohamed-gougam/kube-agent/pkg/client/clientset/versioned"
@@ -34,55 +40,110 @@ const controllerAgentName = "k8s-nginx"
 
 // Controller is the controller implementation
 type Controller struct {
-	kubeclient       kubernetes.Interface
-	confclient       clientset.Interface
-	servicesLister   corelisters.ServiceLister
-	servicesSynced   cache.InformerSynced
-	endpointsLister  corelisters.EndpointsLister
-	endpointsSynced  cache.InformerSynced
-	podLister        corelisters.PodLister
-	tcpServersLister listers.TCPServerLister
-	tcpServersSynced cache.InformerSynced
-	workqueue        workqueue.RateLimitingInterface
-	recorder         record.EventRecorder
-	configurer       *configuration.Configurer
+	kubeclient          kubernetes.Interface
+	confclient          clientset.Interface
+	servicesLister      corelisters.ServiceLister
+	servicesSynced      cache.InformerSynced
+	endpointsLister     corelisters.EndpointsLister
+	endpointsSynced     cache.InformerSynced
+	podLister           corelisters.PodLister
+	podsSynced          cache.InformerSynced
+	tcpServersLister    listers.TCPServerLister
+	tcpServersSynced    cache.InformerSynced
+	configMapLister     corelisters.ConfigMapLister
+	configMapSynced     cache.InformerSynced
+	nginxConfigMaps     string
+	defaultConfigParams *configuration.ConfigParams
+	enableSnippets      bool
+	nginxCapabilities   validation.NginxCapabilities
+	workqueue           workqueue.RateLimitingInterface
+	recorder            record.EventRecorder
+	configurer          *configuration.Configurer
+	metricsCollector    collectors.ControllerCollector
+	states              *tcpServerStateTracker
+	endpointsReports    *endpointsReportStore
+	tcpServerEvents     *tcpServerEventTracker
+	eventTimesLock      sync.Mutex
+	// eventTimes are the times of the earliest informer events of the tasks that were not synced yet.
+	eventTimes         map[task]time.Time
+	readinessLock      sync.Mutex
+	cachesSynced       bool
+	initialSyncPending map[string]bool
+}
+
+// NewControllerInput holds the input needed to call NewController.
+type NewControllerInput struct {
+	KubeClient        kubernetes.Interface
+	ConfClient        clientset.Interface
+	ServiceInformer   coreinformers.ServiceInformer
+	EndpointsInformer coreinformers.EndpointsInformer
+	PodInformer       coreinformers.PodInformer
+	TCPServerInformer informers.TCPServerInformer
+	// ConfigMapInformer is nil if no ConfigMap configures NGINX.
+	ConfigMapInformer coreinformers.ConfigMapInformer
+	// NginxConfigMaps is the namespace/name of the ConfigMap that configures NGINX.
+	NginxConfigMaps string
+	// DefaultConfigParams are used for the keys missing from the ConfigMap, or if the ConfigMap doesn't exist.
+	DefaultConfigParams *configuration.ConfigParams
+	Configurer          *configuration.Configurer
+	// EnableSnippets allows the snippets of the TCPServers.
+	EnableSnippets bool
+	// NginxCapabilities describes the NGINX binary, TCPServers with features it doesn't support are rejected.
+	NginxCapabilities validation.NginxCapabilities
+	MetricsCollector  collectors.ControllerCollector
+	// InformerCollector observes the events of the informers.
+	InformerCollector collectors.InformerCollector
 }
 
 // NewController returns a new controller
-func NewController(kubeclient kubernetes.Interface,
-	confclient clientset.Interface,
-	serviceInformer coreinformers.ServiceInformer,
-	endpointsInformer coreinformers.EndpointsInformer,
-	podInformer coreinformers.PodInformer,
-	tcpServerInformer informers.TCPServerInformer,
-	configurer *configuration.Configurer) *Controller {
+func NewController(input NewControllerInput) *Controller {
 
 	utilruntime.Must(k8snginxscheme.AddToScheme(scheme.Scheme))
-	glog.V(3).Info("Creating event broadcaster")
-	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartLogging(glog.Infof)
-	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclient.CoreV1().Events("")})
+	klog.V(3).InfoS("Creating event broadcaster")
+	eventBroadcaster := record.NewBroadcasterWithCorrelatorOptions(eventCorrelatorOptions)
+	eventBroadcaster.StartEventWatcher(func(e *corev1.Event) {
+		klog.InfoS("Event occurred", "object", klog.KRef(e.InvolvedObject.Namespace, e.InvolvedObject.Name), "kind", e.InvolvedObject.Kind,
+			"type", e.Type, "reason", e.Reason, "message", e.Message)
+	})
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: input.KubeClient.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
 	controller := &Controller{
-		kubeclient:       kubeclient,
-		confclient:       confclient,
-		servicesLister:   serviceInformer.Lister(),
-		endpointsLister:  endpointsInformer.Lister(),
-		endpointsSynced:  endpointsInformer.Informer().HasSynced,
-		podLister:        podInformer.Lister(),
-		tcpServersLister: tcpServerInformer.Lister(),
-		tcpServersSynced: tcpServerInformer.Informer().HasSynced,
-		workqueue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "TCPServers"),
-		recorder:         recorder,
-		configurer:       configurer,
-	}
-
-	glog.Info("Setting up event handlers")
+		kubeclient:          input.KubeClient,
+		confclient:          input.ConfClient,
+		servicesLister:      input.ServiceInformer.Lister(),
+		servicesSynced:      input.ServiceInformer.Informer().HasSynced,
+		endpointsLister:     input.EndpointsInformer.Lister(),
+		endpointsSynced:     input.EndpointsInformer.Informer().HasSynced,
+		podLister:           input.PodInformer.Lister(),
+		podsSynced:          input.PodInformer.Informer().HasSynced,
+		tcpServersLister:    input.TCPServerInformer.Lister(),
+		tcpServersSynced:    input.TCPServerInformer.Informer().HasSynced,
+		nginxConfigMaps:     input.NginxConfigMaps,
+		defaultConfigParams: input.DefaultConfigParams,
+		enableSnippets:      input.EnableSnippets,
+		nginxCapabilities:   input.NginxCapabilities,
+		workqueue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "TCPServers"),
+		recorder:            recorder,
+		configurer:          input.Configurer,
+		metricsCollector:    input.MetricsCollector,
+		states:              newTCPServerStateTracker(input.MetricsCollector),
+		endpointsReports:    newEndpointsReportStore(),
+		tcpServerEvents:     newTCPServerEventTracker(),
+		eventTimes:          make(map[task]time.Time),
+		initialSyncPending:  make(map[string]bool),
+	}
+
+	input.Configurer.SetApplyHandler(controller.handleApplyResult)
+
+	tcpServerInformer := input.TCPServerInformer
+	endpointsInformer := input.EndpointsInformer
+
+	klog.InfoS("Setting up event handlers")
 	tcpServerInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			tcps := obj.(*k8snginx_v1.TCPServer)
-			glog.V(3).Infof("Queue Sync[tcpserver]: Adding TCPServer: %v", tcps.Name)
+			klog.V(3).InfoS("Queueing an added TCPServer", "tcpserver", klog.KObj(tcps))
 			controller.enqueue(obj)
 		},
 		DeleteFunc: func(obj interface{}) {
@@ -90,22 +151,22 @@ func NewController(kubeclient kubernetes.Interface,
 			if !isTcps {
 				delState, ok := obj.(cache.DeletedFinalStateUnknown)
 				if !ok {
-					glog.V(3).Infof("Error: received unexpected object: %v", obj)
+					klog.V(3).InfoS("Received an unexpected object", "object", obj)
 					return
 				}
 				tcps, ok = delState.Obj.(*k8snginx_v1.TCPServer)
 				if !ok {
-					glog.V(3).Infof("Error: DeletedFinalStateUnknown contained non TCPServer object: %v", delState.Obj)
+					klog.V(3).InfoS("DeletedFinalStateUnknown contained a non TCPServer object", "object", delState.Obj)
 					return
 				}
 			}
-			glog.V(3).Infof("Queue Sync[tcpserver]: Removing TCPServer: %v", tcps.Name)
+			klog.V(3).InfoS("Queueing a removed TCPServer", "tcpserver", klog.KObj(tcps))
 			controller.enqueue(obj)
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			if !reflect.DeepEqual(oldObj, newObj) {
 				newTcps := newObj.(*k8snginx_v1.TCPServer)
-				glog.V(3).Infof("Queue Sync[tcpserver]: TCPServer %v updated, apllying changes", newTcps.Name)
+				klog.V(3).InfoS("Queueing an updated TCPServer", "tcpserver", klog.KObj(newTcps))
 				controller.enqueue(newObj)
 			}
 		},
@@ -114,7 +175,7 @@ func NewController(kubeclient kubernetes.Interface,
 	endpointsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			ept := obj.(*corev1.Endpoints)
-			glog.V(3).Infof("Queue Sync[endpoints]: Checking and Adding all TCPServers of namespace %v with serviceName %v", ept.Namespace, ept.Name)
+			klog.V(3).InfoS("Queueing the TCPServers of added endpoints", "service", klog.KObj(ept))
 			controller.enqueueList(controller.getTCPServersForEndpoints(ept.Namespace, ept.Name))
 		},
 		DeleteFunc: func(obj interface{}) {
@@ -122,52 +183,138 @@ func NewController(kubeclient kubernetes.Interface,
 			if !isEpt {
 				delState, ok := obj.(cache.DeletedFinalStateUnknown)
 				if !ok {
-					glog.V(3).Infof("Error: received unexpected object: %v", obj)
+					klog.V(3).InfoS("Received an unexpected object", "object", obj)
 					return
 				}
 				ept, ok = delState.Obj.(*corev1.Endpoints)
 				if !ok {
-					glog.V(3).Infof("Error DeletedFinalStateUnknown contained non endpoints object: %v", delState.Obj)
+					klog.V(3).InfoS("DeletedFinalStateUnknown contained a non Endpoints object", "object", delState.Obj)
 					return
 				}
 			}
-			glog.V(3).Infof("Queue Sync[endpoints]: Removing all TCPServers in namespace %v with serviceName %v", ept.Namespace, ept.Name)
+			klog.V(3).InfoS("Queueing the TCPServers of removed endpoints", "service", klog.KObj(ept))
 			controller.enqueueList(controller.getTCPServersForEndpoints(ept.Namespace, ept.Name))
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			if !reflect.DeepEqual(oldObj, newObj) {
 				ept := newObj.(*corev1.Endpoints)
-				glog.V(3).Infof("Queue Sync[endpoints]: Updating all TCPServers of namespace %v with serviceName %v", ept.Namespace, ept.Name)
+				klog.V(3).InfoS("Queueing the TCPServers of updated endpoints", "service", klog.KObj(ept))
 				controller.enqueueList(controller.getTCPServersForEndpoints(ept.Namespace, ept.Name))
 			}
 		},
 	})
 
+	if input.ConfigMapInformer != nil {
+		controller.configMapLister = input.ConfigMapInformer.Lister()
+		controller.configMapSynced = input.ConfigMapInformer.Informer().HasSynced
+		input.ConfigMapInformer.Informer().AddEventHandler(controller.createConfigMapHandlers())
+		input.ConfigMapInformer.Informer().AddEventHandler(createInformerMetricsHandlers("configmaps", input.InformerCollector))
+	}
+
+	tcpServerInformer.Informer().AddEventHandler(createInformerMetricsHandlers("tcpservers", input.InformerCollector))
+	endpointsInformer.Informer().AddEventHandler(createInformerMetricsHandlers("endpoints", input.InformerCollector))
+	input.ServiceInformer.Informer().AddEventHandler(createInformerMetricsHandlers("services", input.InformerCollector))
+	input.PodInformer.Informer().AddEventHandler(createInformerMetricsHandlers("pods", input.InformerCollector))
+
 	return controller
 }
 
+// createInformerMetricsHandlers returns the handlers that report the events of the informer of the resource,
+// so that a stale API watch can be told apart from a backed up workqueue.
+func createInformerMetricsHandlers(resource string, collector collectors.InformerCollector) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			collector.ObserveEvent(resource, collectors.InformerEventAdd)
+		},
+		DeleteFunc: func(obj interface{}) {
+			collector.ObserveEvent(resource, collectors.InformerEventDelete)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldMeta, oldErr := meta.Accessor(oldObj)
+			newMeta, newErr := meta.Accessor(newObj)
+			if oldErr == nil && newErr == nil && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+				collector.ObserveEvent(resource, collectors.InformerEventResync)
+				return
+			}
+			collector.ObserveEvent(resource, collectors.InformerEventUpdate)
+		},
+	}
+}
+
+func (c *Controller) createConfigMapHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			cfgm := obj.(*corev1.ConfigMap)
+			if c.isNginxConfigMap(cfgm) {
+				klog.V(3).InfoS("Queueing an added ConfigMap", "configMap", klog.KObj(cfgm))
+				c.enqueue(obj)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			cfgm, isCfgm := obj.(*corev1.ConfigMap)
+			if !isCfgm {
+				delState, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					klog.V(3).InfoS("Received an unexpected object", "object", obj)
+					return
+				}
+				cfgm, ok = delState.Obj.(*corev1.ConfigMap)
+				if !ok {
+					klog.V(3).InfoS("DeletedFinalStateUnknown contained a non ConfigMap object", "object", delState.Obj)
+					return
+				}
+			}
+			if c.isNginxConfigMap(cfgm) {
+				klog.V(3).InfoS("Queueing a removed ConfigMap", "configMap", klog.KObj(cfgm))
+				c.enqueue(obj)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if !reflect.DeepEqual(oldObj, newObj) {
+				cfgm := newObj.(*corev1.ConfigMap)
+				if c.isNginxConfigMap(cfgm) {
+					klog.V(3).InfoS("Queueing an updated ConfigMap", "configMap", klog.KObj(cfgm))
+					c.enqueue(newObj)
+				}
+			}
+		},
+	}
+}
+
+func (c *Controller) isNginxConfigMap(cfgm *corev1.ConfigMap) bool {
+	return fmt.Sprintf("%s/%s", cfgm.Namespace, cfgm.Name) == c.nginxConfigMaps
+}
+
 // Run runs the controller with threadiness number of workers.
 func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 	defer utilruntime.HandleCrash()
 	defer c.workqueue.ShutDown()
 
-	glog.Info("Starting Kube-Agent controller")
+	klog.InfoS("Starting Kube-Agent controller")
 
 	// Wait for the caches to be synced before starting workers
-	glog.Info("Waiting for services informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.tcpServersSynced, c.endpointsSynced); !ok {
+	klog.InfoS("Waiting for informer caches to sync")
+	cacheSyncs := []cache.InformerSynced{c.tcpServersSynced, c.servicesSynced, c.endpointsSynced, c.podsSynced}
+	if c.configMapSynced != nil {
+		cacheSyncs = append(cacheSyncs, c.configMapSynced)
+	}
+	if ok := cache.WaitForCacheSync(stopCh, cacheSyncs...); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
-	glog.Info("Starting workers")
+	if err := c.startInitialSync(); err != nil {
+		return err
+	}
+
+	klog.InfoS("Starting workers")
 	// Launch threadiness workers to process TCPServers resources
 	for i := 0; i < threadiness; i++ {
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
 
-	glog.Info("Started workers")
+	klog.InfoS("Started workers")
 	<-stopCh
-	glog.Info("Shutting down workers")
+	klog.InfoS("Shutting down workers")
 
 	return nil
 }
@@ -190,23 +337,25 @@ func (c *Controller) processNextWorkItem() bool {
 	err := func(obj interface{}) error {
 		defer c.workqueue.Done(obj)
 
-		var key string
+		var t task
 		var ok bool
 
-		if key, ok = obj.(string); !ok {
+		if t, ok = obj.(task); !ok {
 			c.workqueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+			utilruntime.HandleError(fmt.Errorf("expected task in workqueue but got %#v", obj))
 			return nil
 		}
 
-		if err := c.syncTCPServers(key); err != nil {
+		eventTime := c.takeEventTime(t)
+		if err := c.sync(t, eventTime); err != nil {
 			// Put the item back on the workqueue to handle any transient errors.
-			c.workqueue.AddRateLimited(key)
-			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+			c.recordEventTime(t, eventTime)
+			c.workqueue.AddRateLimited(t)
+			return fmt.Errorf("error syncing '%s': %s, requeuing", t.key, err.Error())
 		}
 
 		c.workqueue.Forget(obj)
-		glog.Infof("Successfully synced '%s'", key)
+		klog.InfoS("Successfully synced", t.kind.logKey(), getObjectRef(t.key))
 
 		return nil
 	}(obj)
@@ -219,7 +368,73 @@ func (c *Controller) processNextWorkItem() bool {
 	return true
 }
 
-func (c *Controller) syncTCPServers(key string) error {
+// sync syncs the resource of the task. eventTime is the time of the earliest informer event the task was queued for.
+func (c *Controller) sync(t task, eventTime time.Time) error {
+	switch t.kind {
+	case tcpServer:
+		return c.syncTCPServers(t.key, eventTime)
+	case configMap:
+		return c.syncConfigMap(t.key, eventTime)
+	}
+	return nil
+}
+
+func (c *Controller) syncConfigMap(key string, eventTime time.Time) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return nil
+	}
+
+	cfgm, err := c.configMapLister.ConfigMaps(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			// network/transient error, retry
+			return err
+		}
+
+		klog.V(2).InfoS("ConfigMap was deleted, applying the default configuration", "configMap", klog.KRef(namespace, name))
+
+		if err := c.configurer.UpdateConfig(c.defaultConfigParams); err != nil {
+			klog.ErrorS(err, "Error when applying the default configuration", "configMap", klog.KRef(namespace, name))
+			if _, isWriteErr := err.(*nginx.WriteError); isWriteErr {
+				return err
+			}
+			return nil
+		}
+		c.metricsCollector.ObserveEventToLiveLatency("configmap", time.Since(eventTime))
+		return nil
+	}
+
+	klog.V(2).InfoS("Applying configuration from ConfigMap", "configMap", klog.KObj(cfgm))
+
+	cfgParams := configuration.ParseConfigMap(cfgm, c.defaultConfigParams)
+	if err := c.configurer.UpdateConfig(cfgParams); err != nil {
+		klog.ErrorS(err, "Error when applying configuration from ConfigMap", "configMap", klog.KObj(cfgm))
+		c.recorder.Eventf(cfgm, corev1.EventTypeWarning, "UpdatedWithError", "Configuration from %v was updated but not applied: %v", key, err)
+		if _, isWriteErr := err.(*nginx.WriteError); isWriteErr {
+			// the write might succeed later
+			return err
+		}
+		return nil
+	}
+
+	c.recorder.Eventf(cfgm, corev1.EventTypeNormal, "Updated", "Configuration from %v was updated", key)
+	c.metricsCollector.UpdateLastSuccessfulSync(time.Now())
+	c.metricsCollector.ObserveEventToLiveLatency("configmap", time.Since(eventTime))
+
+	return nil
+}
+
+// syncTCPServers syncs the TCPServer with the key to NGINX: its configuration is queued to be applied,
+// or removed if the TCPServer was deleted or is rejected.
+func (c *Controller) syncTCPServers(key string, eventTime time.Time) (err error) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "syncTCPServers", trace.WithAttributes(tracing.TCPServerKey.String(key)))
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
+
 	// Convert the namespace/name string into a distinct namespace and name
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
@@ -230,33 +445,38 @@ func (c *Controller) syncTCPServers(key string) error {
 	tcps, err := c.tcpServersLister.TCPServers(namespace).Get(name)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			glog.V(2).Infof("Deleting TCPServer: %v\n", key)
+			klog.V(2).InfoS("Deleting TCPServer", "tcpserver", klog.KRef(namespace, name))
 
-			err := c.configurer.DeleteTCPServer(key)
-			if err != nil {
-				glog.Errorf("Error when deleting configuration for %v: %v", key, err)
-			}
+			span.SetAttributes(tracing.SyncResultKey.String("deleted"))
+			c.configurer.DeleteTCPServer(ctx, key, eventTime)
+			c.states.deleteState(key)
+			c.endpointsReports.delete(key)
+			c.tcpServerEvents.setWarnings(key, nil)
 			return nil
 		}
 		// network/transient error, retry
 		return err
 	}
 
-	validationErr := validation.ValidateTCPServer(tcps)
+	span.SetAttributes(tracing.TCPServerAttributes(tcps)...)
+
+	validationErr := validation.ValidateTCPServer(tcps, c.enableSnippets, c.nginxCapabilities)
 	if validationErr != nil {
-		err := c.configurer.DeleteTCPServer(key)
-		if err != nil {
-			glog.Errorf("Error when deleting configuration for %v: %v", key, err)
-		}
+		span.SetAttributes(tracing.SyncResultKey.String("invalid"))
+		c.configurer.DeleteTCPServer(ctx, key, eventTime)
 		c.recorder.Eventf(tcps, corev1.EventTypeWarning, "Rejected", "TCPServer %v is invalid and was rejected: %v", key, validationErr)
+		c.states.setState(tcps, tcpServerStateInvalid, 0)
+		c.endpointsReports.delete(key)
+		c.tcpServerEvents.setWarnings(key, nil)
+		c.metricsCollector.IncSyncErrors(syncErrorValidation)
 		return nil
 	}
 
 	svc, err := c.servicesLister.Services(namespace).Get(tcps.Spec.ServiceName)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			glog.V(2).Infof("Adding or Updating TCPServer with serverName %v of a non existant service.\n", tcps.Spec.ServiceName)
-			c.addOrUpdateTCPServerSync(tcps, &corev1.Service{}, &corev1.Endpoints{})
+			klog.V(2).InfoS("Adding or updating TCPServer of a non existent service", "tcpserver", klog.KObj(tcps), "service", klog.KRef(namespace, tcps.Spec.ServiceName))
+			c.addOrUpdateTCPServerSync(ctx, tcps, nil, nil, eventTime)
 			return nil
 		}
 		// network/transient error, retry
@@ -266,53 +486,148 @@ func (c *Controller) syncTCPServers(key string) error {
 	ept, err := c.endpointsLister.Endpoints(namespace).Get(tcps.Spec.ServiceName)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			glog.V(2).Infof("Adding or Updating TCPServer with serverName %v of a service with no endpoints.\n", tcps.Spec.ServiceName)
-			c.addOrUpdateTCPServerSync(tcps, svc, &corev1.Endpoints{})
+			klog.V(2).InfoS("Adding or updating TCPServer of a service with no endpoints", "tcpserver", klog.KObj(tcps), "service", klog.KRef(namespace, tcps.Spec.ServiceName))
+			c.addOrUpdateTCPServerSync(ctx, tcps, svc, nil, eventTime)
 			return nil
 		}
 		// network/transient error, retry
 		return err
 	}
 
-	glog.V(2).Infof("Adding or updating TCPServer %v\n", key)
+	klog.V(2).InfoS("Adding or updating TCPServer", "tcpserver", klog.KObj(tcps), "service", klog.KRef(namespace, tcps.Spec.ServiceName))
 
-	c.addOrUpdateTCPServerSync(tcps, svc, ept)
+	c.addOrUpdateTCPServerSync(ctx, tcps, svc, ept, eventTime)
 
 	return nil
 }
 
-func (c *Controller) addOrUpdateTCPServerSync(tcps *k8snginx_v1.TCPServer, svc *corev1.Service, endpoints *corev1.Endpoints) {
-	var stcpAdrs []string
+// addOrUpdateTCPServerSync adds or updates the TCPServer in NGINX. svc is nil if the service of the TCPServer doesn't exist,
+// endpoints is nil if the endpoints of the service don't exist.
+func (c *Controller) addOrUpdateTCPServerSync(ctx context.Context, tcps *k8snginx_v1.TCPServer, svc *corev1.Service, endpoints *corev1.Endpoints,
+	eventTime time.Time) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.SyncResultKey.String("applied"))
 
-	adrs, err := c.getEndpointsForServiceAndPort(tcps.Spec.ServicePort, svc, endpoints)
-	if err != nil {
-		glog.V(3).Infof("Error getting endpoints for service %s/%s port %v: %v", svc.Namespace, svc.Name, tcps.Spec.ServicePort, err)
-	} else {
-		stcpAdrs = append(stcpAdrs, adrs...)
+	stcpAdrs, endpointsReport := c.getEndpointsForTCPServer(ctx, tcps, svc, endpoints)
+	if endpointsReport.Error != "" {
+		klog.V(3).InfoS("TCPServer has no endpoints", "tcpserver", klog.KObj(tcps), "service", klog.KRef(tcps.Namespace, tcps.Spec.ServiceName), "port", tcps.Spec.ServicePort, "reason", endpointsReport.Error)
 	}
+	c.endpointsReports.set(getTCPServerKey(tcps), endpointsReport)
+	c.recordWarnings(tcps, getEndpointsWarnings(tcps, svc, stcpAdrs, endpointsReport))
 
 	// Not exiting with error. Will serve tcp port 37 instead, default time.
 
 	tcpsEx, err := configuration.NewTCPServerEx(tcps, stcpAdrs)
 	if err != nil {
 		// this case is impossible to happen
-		glog.Errorf("Error when creating TCPServerEx for %s/%s: %v", tcps.Namespace, tcps.Name, err)
+		klog.ErrorS(err, "Error when creating TCPServerEx", "tcpserver", klog.KObj(tcps))
 		c.recorder.Eventf(tcps, corev1.EventTypeWarning, "Altered", "Error creating TCPServerEx from TCPServer %s/%s: %v", tcps.Namespace, tcps.Name, err)
 	}
-	if err = c.configurer.AddOrUpdateTCPServer(tcpsEx); err != nil {
-		glog.Errorf("Error when creating TCPServer NGINX config for %s/%s: %v", tcps.Namespace, tcps.Name, err)
+	if err = c.configurer.AddOrUpdateTCPServer(ctx, tcpsEx, eventTime); err != nil {
+		span.SetAttributes(tracing.SyncResultKey.String("invalid"))
+		klog.ErrorS(err, "Error when creating TCPServer NGINX config", "tcpserver", klog.KObj(tcps))
 		c.recorder.Eventf(tcps, corev1.EventTypeWarning, "AddedOrUpdatedWithError", "Configuration for %s/%s was added or updated but not applied %v", tcps.Namespace, tcps.Name, err)
+		c.states.setState(tcps, tcpServerStateInvalid, 0)
+		c.metricsCollector.IncSyncErrors(syncErrorRender)
+		c.markInitialSynced(getTCPServerKey(tcps))
+	}
+}
+
+// handleApplyResult reports the result of applying a batch of changes to NGINX for a single TCPServer.
+// eventTime is the time of the earliest informer event the change was queued for.
+func (c *Controller) handleApplyResult(key string, tcpsEx *configuration.TCPServerEx, eventTime time.Time, err error) {
+	if _, isWriteErr := err.(*nginx.WriteError); !isWriteErr {
+		// write errors are retried
+		c.markInitialSynced(key)
+	}
+
+	if err == nil {
+		klog.V(3).InfoS("Configuration was applied", "tcpserver", getObjectRef(key))
+		c.metricsCollector.UpdateLastSuccessfulSync(time.Now())
+		c.metricsCollector.ObserveEventToLiveLatency("tcpserver", time.Since(eventTime))
+		if tcpsEx == nil {
+			c.recordRemovedEvent(key)
+		} else {
+			c.recordAppliedEvent(key, tcpsEx)
+			state := tcpServerStateValid
+			if len(tcpsEx.ServiceAddresses) == 0 {
+				state = tcpServerStateNoEndpoints
+			}
+			c.states.setState(tcpsEx.TCPServer, state, len(tcpsEx.ServiceAddresses))
+		}
+		return
 	}
+
+	if tcpsEx == nil {
+		klog.ErrorS(err, "Error when deleting configuration", "tcpserver", getObjectRef(key))
+		if _, isWriteErr := err.(*nginx.WriteError); isWriteErr {
+			c.metricsCollector.IncSyncErrors(syncErrorWrite)
+			c.requeueWithEventTime(task{kind: tcpServer, key: key}, eventTime)
+		}
+		return
+	}
+
+	klog.ErrorS(err, "Error when applying TCPServer NGINX config", "tcpserver", getObjectRef(key))
+
+	if _, isWriteErr := err.(*nginx.WriteError); isWriteErr {
+		// the state is kept, as NGINX runs the previous configuration of the TCPServer until the retry
+		c.recorder.Eventf(tcpsEx.TCPServer, corev1.EventTypeWarning, "AddedOrUpdatedWithError", "Configuration for %v was not applied and will be retried: %v", key, err)
+		c.metricsCollector.IncSyncErrors(syncErrorWrite)
+		c.requeueWithEventTime(task{kind: tcpServer, key: key}, eventTime)
+		return
+	}
+
+	if _, isRollbackErr := err.(*nginx.RollbackError); isRollbackErr {
+		c.recorder.Eventf(tcpsEx.TCPServer, corev1.EventTypeWarning, "RolledBack", "Configuration for %v was not applied, NGINX was rolled back to the last good configuration: %v", key, err)
+		c.metricsCollector.IncSyncErrors(syncErrorRollback)
+		return
+	}
+
+	c.recorder.Eventf(tcpsEx.TCPServer, corev1.EventTypeWarning, "AddedOrUpdatedWithError", "Configuration for %v was added or updated but not applied %v", key, err)
+	c.states.setState(tcpsEx.TCPServer, tcpServerStateInvalid, 0)
+	c.metricsCollector.IncSyncErrors(syncErrorConfig)
 }
 
 func (c *Controller) enqueue(obj interface{}) {
-	var key string
-	var err error
-	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
+	t, err := newTask(obj)
+	if err != nil {
 		utilruntime.HandleError(err)
 		return
 	}
-	c.workqueue.Add(key)
+	c.recordEventTime(t, time.Now())
+	c.workqueue.Add(t)
+}
+
+// requeueWithEventTime requeues the task with rate limiting, keeping the time of the event it was queued for.
+func (c *Controller) requeueWithEventTime(t task, eventTime time.Time) {
+	c.recordEventTime(t, eventTime)
+	c.workqueue.AddRateLimited(t)
+}
+
+// recordEventTime records the time of an event of the task, unless an earlier event of the task is not synced yet.
+// The workqueue merges the tasks of the events, so the latency of a sync is measured from the earliest event.
+func (c *Controller) recordEventTime(t task, eventTime time.Time) {
+	c.eventTimesLock.Lock()
+	defer c.eventTimesLock.Unlock()
+
+	if prev, exists := c.eventTimes[t]; exists && prev.Before(eventTime) {
+		return
+	}
+	c.eventTimes[t] = eventTime
+}
+
+// takeEventTime returns the time of the earliest event of the task, before the task is synced.
+// The events recorded afterwards are synced by the next sync of the task.
+func (c *Controller) takeEventTime(t task) time.Time {
+	c.eventTimesLock.Lock()
+	defer c.eventTimesLock.Unlock()
+
+	eventTime, exists := c.eventTimes[t]
+	if !exists {
+		return time.Now()
+	}
+	delete(c.eventTimes, t)
+	return eventTime
 }
 
 func (c *Controller) enqueueList(tcpss []*k8snginx_v1.TCPServer) {
@@ -329,7 +644,7 @@ func (c *Controller) getTCPServersForEndpoints(endpointsNamespace, endpointsName
 
 	for _, tcps := range tcpss {
 		if tcps.Spec.ServiceName == endpointsName {
-			glog.V(3).Infof("Queue sync: TCPServer %s/%s synced.", tcps.Namespace, tcps.Name)
+			klog.V(3).InfoS("Found TCPServer of the endpoints", "tcpserver", klog.KObj(tcps), "service", klog.KRef(endpointsNamespace, endpointsName))
 			result = append(result, tcps)
 		}
 	}
@@ -342,7 +657,7 @@ func (c *Controller) getTCPServersInNamespace(namespace string) []*k8snginx_v1.T
 
 	tcpss, err := c.tcpServersLister.TCPServers(namespace).List(labels.Everything())
 	if err != nil {
-		glog.Errorf("Error listing TCPServers of namespace %v: %v", namespace, err)
+		klog.ErrorS(err, "Error listing TCPServers", "namespace", namespace)
 		return result
 	}
 
@@ -350,66 +665,3 @@ func (c *Controller) getTCPServersInNamespace(namespace string) []*k8snginx_v1.T
 
 	return result
 }
-
-func (c *Controller) getEndpointsForServiceAndPort(tcpsServicePort int, svc *corev1.Service, endpoints *corev1.Endpoints) ([]string, error) {
-	var targetPort int32
-	var err error
-
-	for _, port := range svc.Spec.Ports {
-		if int(port.Port) == tcpsServicePort {
-			targetPort, err = c.getTargetPort(&port, svc)
-			if err != nil {
-				return nil, fmt.Errorf("Error determining target port for port %v in Ingress: %v", tcpsServicePort, err)
-			}
-			break
-		}
-	}
-
-	if targetPort == 0 {
-		return nil, fmt.Errorf("No port %v in service %s/%s", tcpsServicePort, svc.Namespace, svc.Name)
-	}
-
-	for _, eptSub := range endpoints.Subsets {
-		for _, eptPort := range eptSub.Ports {
-			if eptPort.Port == targetPort {
-				var stcpAdrs []string
-				for _, eptAdr := range eptSub.Addresses {
-					stcpAdrs = append(stcpAdrs, fmt.Sprintf("%s:%v", eptAdr.IP, eptPort.Port))
-				}
-				return stcpAdrs, nil
-			}
-		}
-	}
-
-	return nil, fmt.Errorf("No endpoints for target port %v in service %s", targetPort, svc.Name)
-}
-
-// Integrated from nginx-ingress
-func (c *Controller) getTargetPort(svcPort *corev1.ServicePort, svc *corev1.Service) (int32, error) {
-	if (svcPort.TargetPort == intstr.IntOrString{}) {
-		return svcPort.Port, nil
-	}
-
-	if svcPort.TargetPort.Type == intstr.Int {
-		return int32(svcPort.TargetPort.IntValue()), nil
-	}
-
-	//CHANGED To use own podLister
-	pods, err := c.podLister.List(labels.Set(svc.Spec.Selector).AsSelector())
-	if err != nil {
-		return 0, fmt.Errorf("Error getting pod information: %v", err)
-	}
-
-	if len(pods) == 0 {
-		return 0, fmt.Errorf("No pods of service %s", svc.Name)
-	}
-
-	pod := pods[0]
-
-	portNum, err := findPort(pod, svcPort)
-	if err != nil {
-		return 0, fmt.Errorf("Error finding named port %v in pod %s: %v", svcPort, pod.Name, err)
-	}
-
-	return portNum, nil
-}
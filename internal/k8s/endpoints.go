@@ -0,0 +1,267 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/mohamed-gougam/kube-agent/internal/tracing"
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+// The reasons an address of the endpoints of a service is included in, or excluded from, the upstream servers
+// of a TCPServer.
+const (
+	EndpointReasonIncluded = "included"
+	// EndpointReasonPortMismatch means that the address doesn't serve the target port of the service port of the TCPServer,
+	// or that the service has no such port.
+	EndpointReasonPortMismatch = "port mismatch"
+	// EndpointReasonNotReady means that the address serves the target port, but is not ready.
+	EndpointReasonNotReady = "not ready"
+	// EndpointReasonMissingPod means that the target port is a named port, which can't be resolved without the pods of the service.
+	EndpointReasonMissingPod = "missing pod"
+	// EndpointReasonOtherSubset means that the address serves the target port, but in a subset of the endpoints after
+	// the first subset that serves it. Only the addresses of the first subset are upstream servers.
+	EndpointReasonOtherSubset = "other subset"
+)
+
+// EndpointReport explains why an address of the endpoints of a service is, or isn't, an upstream server of a TCPServer.
+type EndpointReport struct {
+	Address  string  `json:"address"`
+	Ports    []int32 `json:"ports"`
+	Included bool    `json:"included"`
+	Reason   string  `json:"reason"`
+}
+
+// EndpointsReport explains how the upstream servers of a TCPServer were selected from the endpoints of its service.
+type EndpointsReport struct {
+	Service     string `json:"service"`
+	ServicePort int    `json:"servicePort"`
+	TargetPort  int32  `json:"targetPort,omitempty"`
+	// Error is why the TCPServer has no upstream servers.
+	Error     string           `json:"error,omitempty"`
+	Endpoints []EndpointReport `json:"endpoints"`
+}
+
+// missingPodError is returned if the target port of a service can't be determined because the service has no pods.
+type missingPodError struct {
+	Service string
+}
+
+func (e *missingPodError) Error() string {
+	return fmt.Sprintf("No pods of service %s", e.Service)
+}
+
+// endpointsReportStore keeps the last EndpointsReport of every TCPServer.
+type endpointsReportStore struct {
+	lock    sync.RWMutex
+	reports map[string]*EndpointsReport
+}
+
+func newEndpointsReportStore() *endpointsReportStore {
+	return &endpointsReportStore{
+		reports: make(map[string]*EndpointsReport),
+	}
+}
+
+func (s *endpointsReportStore) set(key string, report *EndpointsReport) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.reports[key] = report
+}
+
+func (s *endpointsReportStore) delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.reports, key)
+}
+
+func (s *endpointsReportStore) getAll() map[string]*EndpointsReport {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	reports := make(map[string]*EndpointsReport, len(s.reports))
+	for key, report := range s.reports {
+		reports[key] = report
+	}
+
+	return reports
+}
+
+// GetEndpointsReports returns the EndpointsReports of the TCPServers in NGINX, by TCPServer key.
+func (c *Controller) GetEndpointsReports() map[string]*EndpointsReport {
+	return c.endpointsReports.getAll()
+}
+
+// getEndpointsForTCPServer returns the addresses of the first subset of the endpoints of the service that serves the service port
+// of the TCPServer, and the report of why each address of the endpoints is included or excluded.
+// svc is nil if the service doesn't exist, endpoints is nil if the endpoints of the service don't exist.
+func (c *Controller) getEndpointsForTCPServer(ctx context.Context, tcps *k8snginx_v1.TCPServer, svc *corev1.Service,
+	endpoints *corev1.Endpoints) (addresses []string, report *EndpointsReport) {
+	ctx, span := tracing.Tracer().Start(ctx, "getEndpointsForTCPServer")
+	defer func() {
+		span.SetAttributes(tracing.TCPServerUpstreamsKey.Int(len(addresses)))
+		if report.Error != "" {
+			span.SetAttributes(tracing.EndpointsErrorKey.String(report.Error))
+		}
+		span.End()
+	}()
+
+	report = &EndpointsReport{
+		Service:     fmt.Sprintf("%s/%s", tcps.Namespace, tcps.Spec.ServiceName),
+		ServicePort: tcps.Spec.ServicePort,
+	}
+
+	if svc == nil {
+		report.Error = fmt.Sprintf("Service %s doesn't exist", report.Service)
+		return nil, report
+	}
+	if endpoints == nil {
+		endpoints = &corev1.Endpoints{}
+	}
+
+	targetPort, err := c.getTargetPortForServicePort(ctx, tcps.Spec.ServicePort, svc)
+	if err != nil {
+		report.Error = err.Error()
+		reason := EndpointReasonPortMismatch
+		if _, isMissingPodErr := err.(*missingPodError); isMissingPodErr {
+			reason = EndpointReasonMissingPod
+		}
+		report.Endpoints = getExcludedEndpointReports(endpoints, reason)
+		return nil, report
+	}
+	report.TargetPort = targetPort
+
+	foundSubset := false
+	for _, subset := range endpoints.Subsets {
+		ports := getEndpointPorts(subset)
+
+		excludedReason := ""
+		if !hasEndpointPort(subset, targetPort) {
+			excludedReason = EndpointReasonPortMismatch
+		} else if foundSubset {
+			excludedReason = EndpointReasonOtherSubset
+		}
+
+		if excludedReason != "" {
+			for _, address := range subset.Addresses {
+				report.Endpoints = append(report.Endpoints, EndpointReport{Address: address.IP, Ports: ports, Reason: excludedReason})
+			}
+			for _, address := range subset.NotReadyAddresses {
+				report.Endpoints = append(report.Endpoints, EndpointReport{Address: address.IP, Ports: ports, Reason: excludedReason})
+			}
+			continue
+		}
+
+		foundSubset = true
+		for _, address := range subset.Addresses {
+			addresses = append(addresses, fmt.Sprintf("%s:%v", address.IP, targetPort))
+			report.Endpoints = append(report.Endpoints, EndpointReport{Address: address.IP, Ports: ports, Included: true, Reason: EndpointReasonIncluded})
+		}
+		for _, address := range subset.NotReadyAddresses {
+			report.Endpoints = append(report.Endpoints, EndpointReport{Address: address.IP, Ports: ports, Reason: EndpointReasonNotReady})
+		}
+	}
+
+	if len(addresses) == 0 {
+		report.Error = fmt.Sprintf("No endpoints for target port %v in service %s", targetPort, report.Service)
+	}
+
+	return addresses, report
+}
+
+// getTargetPortForServicePort returns the target port of the port of the service.
+func (c *Controller) getTargetPortForServicePort(ctx context.Context, servicePort int, svc *corev1.Service) (int32, error) {
+	for _, port := range svc.Spec.Ports {
+		if int(port.Port) == servicePort {
+			targetPort, err := c.getTargetPort(ctx, &port, svc)
+			if err != nil {
+				if _, isMissingPodErr := err.(*missingPodError); isMissingPodErr {
+					return 0, err
+				}
+				return 0, fmt.Errorf("Error determining target port for port %v in service %s/%s: %v", servicePort, svc.Namespace, svc.Name, err)
+			}
+			return targetPort, nil
+		}
+	}
+
+	return 0, fmt.Errorf("No port %v in service %s/%s", servicePort, svc.Namespace, svc.Name)
+}
+
+// Integrated from nginx-ingress
+func (c *Controller) getTargetPort(ctx context.Context, svcPort *corev1.ServicePort, svc *corev1.Service) (int32, error) {
+	if (svcPort.TargetPort == intstr.IntOrString{}) {
+		return svcPort.Port, nil
+	}
+
+	if svcPort.TargetPort.Type == intstr.Int {
+		return int32(svcPort.TargetPort.IntValue()), nil
+	}
+
+	//CHANGED To use own podLister
+	_, span := tracing.Tracer().Start(ctx, "PodLister.List")
+	pods, err := c.podLister.List(labels.Set(svc.Spec.Selector).AsSelector())
+	span.SetAttributes(tracing.PodsKey.Int(len(pods)))
+	span.End()
+	if err != nil {
+		return 0, fmt.Errorf("Error getting pod information: %v", err)
+	}
+
+	if len(pods) == 0 {
+		return 0, &missingPodError{Service: fmt.Sprintf("%s/%s", svc.Namespace, svc.Name)}
+	}
+
+	pod := pods[0]
+
+	portNum, err := findPort(pod, svcPort)
+	if err != nil {
+		return 0, fmt.Errorf("Error finding named port %v in pod %s: %v", svcPort, pod.Name, err)
+	}
+
+	return portNum, nil
+}
+
+// getExcludedEndpointReports reports every address of the endpoints as excluded for the reason.
+func getExcludedEndpointReports(endpoints *corev1.Endpoints, reason string) []EndpointReport {
+	var reports []EndpointReport
+	for _, subset := range endpoints.Subsets {
+		ports := getEndpointPorts(subset)
+		for _, address := range subset.Addresses {
+			reports = append(reports, EndpointReport{Address: address.IP, Ports: ports, Reason: reason})
+		}
+		for _, address := range subset.NotReadyAddresses {
+			reports = append(reports, EndpointReport{Address: address.IP, Ports: ports, Reason: reason})
+		}
+	}
+
+	return reports
+}
+
+func getEndpointPorts(subset corev1.EndpointSubset) []int32 {
+	var ports []int32
+	for _, port := range subset.Ports {
+		ports = append(ports, port.Port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i] < ports[j]
+	})
+
+	return ports
+}
+
+func hasEndpointPort(subset corev1.EndpointSubset, port int32) bool {
+	for _, eptPort := range subset.Ports {
+		if eptPort.Port == port {
+			return true
+		}
+	}
+
+	return false
+}
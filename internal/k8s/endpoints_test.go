@@ -0,0 +1,186 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+func createTestEndpointsController() *Controller {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return &Controller{
+		podLister: corelisters.NewPodLister(indexer),
+	}
+}
+
+func createTestEndpointsTCPServer() *k8snginx_v1.TCPServer {
+	return &k8snginx_v1.TCPServer{
+		ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "tcps"},
+		Spec: k8snginx_v1.TCPServerSpec{
+			ListenPort:  5000,
+			ServiceName: "svc",
+			ServicePort: 80,
+		},
+	}
+}
+
+func createTestService(targetPort intstr.IntOrString) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "svc"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Port: 80, TargetPort: targetPort},
+			},
+		},
+	}
+}
+
+func TestGetEndpointsForTCPServer(t *testing.T) {
+	c := createTestEndpointsController()
+	tcps := createTestEndpointsTCPServer()
+	svc := createTestService(intstr.FromInt(8080))
+	endpoints := &corev1.Endpoints{
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses:         []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+				Ports:             []corev1.EndpointPort{{Port: 8080}},
+			},
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.3"}},
+				Ports:     []corev1.EndpointPort{{Port: 9090}},
+			},
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.4"}},
+				Ports:     []corev1.EndpointPort{{Port: 9090}, {Port: 8080}},
+			},
+		},
+	}
+
+	addresses, report := c.getEndpointsForTCPServer(context.Background(), tcps, svc, endpoints)
+
+	// only the first subset with the target port is used
+	expectedAddresses := []string{"10.0.0.1:8080"}
+	if !reflect.DeepEqual(addresses, expectedAddresses) {
+		t.Errorf("getEndpointsForTCPServer() returned the addresses %v, expected %v", addresses, expectedAddresses)
+	}
+
+	expectedReport := &EndpointsReport{
+		Service:     "default/svc",
+		ServicePort: 80,
+		TargetPort:  8080,
+		Endpoints: []EndpointReport{
+			{Address: "10.0.0.1", Ports: []int32{8080}, Included: true, Reason: EndpointReasonIncluded},
+			{Address: "10.0.0.2", Ports: []int32{8080}, Reason: EndpointReasonNotReady},
+			{Address: "10.0.0.3", Ports: []int32{9090}, Reason: EndpointReasonPortMismatch},
+			{Address: "10.0.0.4", Ports: []int32{8080, 9090}, Reason: EndpointReasonOtherSubset},
+		},
+	}
+	if !reflect.DeepEqual(report, expectedReport) {
+		t.Errorf("getEndpointsForTCPServer() returned the report %+v, expected %+v", report, expectedReport)
+	}
+}
+
+func TestGetEndpointsForTCPServerUsesFirstSubsetWithTargetPort(t *testing.T) {
+	c := createTestEndpointsController()
+	tcps := createTestEndpointsTCPServer()
+	svc := createTestService(intstr.FromInt(8080))
+	endpoints := &corev1.Endpoints{
+		Subsets: []corev1.EndpointSubset{
+			{
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				Ports:             []corev1.EndpointPort{{Port: 8080}},
+			},
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+				Ports:     []corev1.EndpointPort{{Port: 8080}},
+			},
+		},
+	}
+
+	// the ready addresses of the later subsets are not used, even if the first subset has no ready address
+	addresses, report := c.getEndpointsForTCPServer(context.Background(), tcps, svc, endpoints)
+	if len(addresses) != 0 {
+		t.Errorf("getEndpointsForTCPServer() returned the addresses %v, expected none", addresses)
+	}
+
+	expectedEndpoints := []EndpointReport{
+		{Address: "10.0.0.1", Ports: []int32{8080}, Reason: EndpointReasonNotReady},
+		{Address: "10.0.0.2", Ports: []int32{8080}, Reason: EndpointReasonOtherSubset},
+	}
+	if !reflect.DeepEqual(report.Endpoints, expectedEndpoints) {
+		t.Errorf("getEndpointsForTCPServer() returned the endpoint reports %+v, expected %+v", report.Endpoints, expectedEndpoints)
+	}
+}
+
+func TestGetEndpointsForTCPServerExcludesAllEndpoints(t *testing.T) {
+	endpoints := &corev1.Endpoints{
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				Ports:     []corev1.EndpointPort{{Port: 8080}},
+			},
+		},
+	}
+
+	tests := []struct {
+		svc            *corev1.Service
+		expectedReason string
+		msg            string
+	}{
+		{
+			svc:            createTestService(intstr.FromString("http")),
+			expectedReason: EndpointReasonMissingPod,
+			msg:            "named target port without pods",
+		},
+		{
+			svc: &corev1.Service{
+				ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "svc"},
+				Spec: corev1.ServiceSpec{
+					Ports: []corev1.ServicePort{{Port: 443}},
+				},
+			},
+			expectedReason: EndpointReasonPortMismatch,
+			msg:            "missing service port",
+		},
+	}
+
+	for _, test := range tests {
+		c := createTestEndpointsController()
+		addresses, report := c.getEndpointsForTCPServer(context.Background(), createTestEndpointsTCPServer(), test.svc, endpoints)
+
+		if len(addresses) != 0 {
+			t.Errorf("getEndpointsForTCPServer() returned the addresses %v for the case of %s, expected none", addresses, test.msg)
+		}
+		if report.Error == "" {
+			t.Errorf("getEndpointsForTCPServer() returned a report without an error for the case of %s", test.msg)
+		}
+		expectedEndpoints := []EndpointReport{
+			{Address: "10.0.0.1", Ports: []int32{8080}, Reason: test.expectedReason},
+		}
+		if !reflect.DeepEqual(report.Endpoints, expectedEndpoints) {
+			t.Errorf("getEndpointsForTCPServer() reported the endpoints %+v for the case of %s, expected %+v", report.Endpoints, test.msg, expectedEndpoints)
+		}
+	}
+}
+
+func TestGetEndpointsForTCPServerWithoutService(t *testing.T) {
+	c := createTestEndpointsController()
+
+	addresses, report := c.getEndpointsForTCPServer(context.Background(), createTestEndpointsTCPServer(), nil, nil)
+
+	if len(addresses) != 0 {
+		t.Errorf("getEndpointsForTCPServer() returned the addresses %v for a missing service, expected none", addresses)
+	}
+	if report.Error == "" {
+		t.Errorf("getEndpointsForTCPServer() returned a report without an error for a missing service")
+	}
+}
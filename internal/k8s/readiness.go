@@ -0,0 +1,60 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// startInitialSync records the TCPServers that exist once the caches have synced. The controller is ready
+// once all of them are synced to NGINX.
+func (c *Controller) startInitialSync() error {
+	tcpss, err := c.tcpServersLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list the TCPServers: %v", err)
+	}
+
+	c.readinessLock.Lock()
+	defer c.readinessLock.Unlock()
+
+	for _, tcps := range tcpss {
+		c.initialSyncPending[getTCPServerKey(tcps)] = true
+	}
+	c.cachesSynced = true
+
+	klog.V(3).InfoS("Waiting for the initial sync of the TCPServers", "tcpservers", len(c.initialSyncPending))
+
+	return nil
+}
+
+// markInitialSynced records that the TCPServer is synced to NGINX, whether it was applied or rejected.
+func (c *Controller) markInitialSynced(key string) {
+	c.readinessLock.Lock()
+	defer c.readinessLock.Unlock()
+
+	if !c.initialSyncPending[key] {
+		return
+	}
+
+	delete(c.initialSyncPending, key)
+	if len(c.initialSyncPending) == 0 {
+		klog.InfoS("The initial sync of the TCPServers is done")
+	}
+}
+
+// CheckReady returns an error until the caches have synced and the TCPServers that existed then are synced to NGINX.
+func (c *Controller) CheckReady() error {
+	c.readinessLock.Lock()
+	defer c.readinessLock.Unlock()
+
+	if !c.cachesSynced {
+		return fmt.Errorf("the caches have not synced")
+	}
+
+	if len(c.initialSyncPending) > 0 {
+		return fmt.Errorf("%v TCPServers are waiting for the initial sync", len(c.initialSyncPending))
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package k8s
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+type kind int
+
+const (
+	tcpServer kind = iota
+	configMap
+)
+
+// logKey returns the key of the resources of the kind in the logs.
+func (k kind) logKey() string {
+	if k == configMap {
+		return "configMap"
+	}
+	return "tcpserver"
+}
+
+// task is an item of the workqueue: the key of a resource of the given kind to sync.
+type task struct {
+	kind kind
+	key  string
+}
+
+// newTask creates a new task for the object.
+func newTask(obj interface{}) (task, error) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return task{}, fmt.Errorf("couldn't get key for object %v: %v", obj, err)
+	}
+
+	var k kind
+	switch t := obj.(type) {
+	case *k8snginx_v1.TCPServer:
+		k = tcpServer
+	case *v1.ConfigMap:
+		k = configMap
+	case cache.DeletedFinalStateUnknown:
+		return newTask(t.Obj)
+	default:
+		return task{}, fmt.Errorf("job for object of type %T is not supported", obj)
+	}
+
+	return task{kind: k, key: key}, nil
+}
+
+// getObjectRef returns the namespace/name reference of the resource with the key, for the logs.
+func getObjectRef(key string) klog.ObjectRef {
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	return klog.KRef(namespace, name)
+}
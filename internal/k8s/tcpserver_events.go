@@ -0,0 +1,217 @@
+package k8s
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/mohamed-gougam/kube-agent/internal/configuration"
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+// upstreamServersChangedReason is the reason of the events about the number of upstream servers of a TCPServer,
+// which change with the endpoints of its service.
+const upstreamServersChangedReason = "UpstreamServersChanged"
+
+// The changes of a TCPServer in NGINX.
+const (
+	tcpServerUnchanged = iota
+	tcpServerAdded
+	tcpServerUpdated
+	tcpServerUpstreamServersChanged
+)
+
+// tcpServerWarning is a Warning event about a TCPServer.
+type tcpServerWarning struct {
+	reason  string
+	message string
+}
+
+type appliedTCPServer struct {
+	spec            k8snginx_v1.TCPServerSpec
+	upstreamServers int
+}
+
+// tcpServerEventTracker keeps what the events of the TCPServers were last recorded for, so that the events are only
+// recorded when something changes, and not on every sync.
+type tcpServerEventTracker struct {
+	lock     sync.Mutex
+	applied  map[string]appliedTCPServer
+	warnings map[string][]tcpServerWarning
+}
+
+func newTCPServerEventTracker() *tcpServerEventTracker {
+	return &tcpServerEventTracker{
+		applied:  make(map[string]appliedTCPServer),
+		warnings: make(map[string][]tcpServerWarning),
+	}
+}
+
+// setApplied records the TCPServerEx applied to NGINX for the TCPServer with the key and returns how the TCPServer changed.
+func (t *tcpServerEventTracker) setApplied(key string, tcpServerEx *configuration.TCPServerEx) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	applied := appliedTCPServer{
+		spec:            tcpServerEx.TCPServer.Spec,
+		upstreamServers: len(tcpServerEx.ServiceAddresses),
+	}
+
+	prev, exists := t.applied[key]
+	t.applied[key] = applied
+
+	switch {
+	case !exists:
+		return tcpServerAdded
+	case !reflect.DeepEqual(prev.spec, applied.spec):
+		return tcpServerUpdated
+	case prev.upstreamServers != applied.upstreamServers:
+		return tcpServerUpstreamServersChanged
+	}
+
+	return tcpServerUnchanged
+}
+
+// deleteApplied records that the TCPServer with the key was removed from NGINX. Returns false if it wasn't in NGINX.
+func (t *tcpServerEventTracker) deleteApplied(key string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	_, exists := t.applied[key]
+	delete(t.applied, key)
+
+	return exists
+}
+
+// setWarnings records the current warnings of the TCPServer with the key and returns the ones that weren't current before.
+func (t *tcpServerEventTracker) setWarnings(key string, warnings []tcpServerWarning) []tcpServerWarning {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var newWarnings []tcpServerWarning
+	for _, warning := range warnings {
+		if !containsWarning(t.warnings[key], warning) {
+			newWarnings = append(newWarnings, warning)
+		}
+	}
+
+	if len(warnings) == 0 {
+		delete(t.warnings, key)
+	} else {
+		t.warnings[key] = warnings
+	}
+
+	return newWarnings
+}
+
+func containsWarning(warnings []tcpServerWarning, warning tcpServerWarning) bool {
+	for _, w := range warnings {
+		if w == warning {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getEndpointsWarnings returns the warnings about the service and the endpoints of the TCPServer.
+// svc is nil if the service doesn't exist.
+func getEndpointsWarnings(tcps *k8snginx_v1.TCPServer, svc *corev1.Service, addresses []string, report *EndpointsReport) []tcpServerWarning {
+	var warnings []tcpServerWarning
+
+	if svc == nil {
+		warnings = append(warnings, tcpServerWarning{
+			reason:  "ServiceNotFound",
+			message: fmt.Sprintf("Service %v of TCPServer %v doesn't exist", report.Service, getTCPServerKey(tcps)),
+		})
+	} else if !hasServicePort(svc, tcps.Spec.ServicePort) {
+		warnings = append(warnings, tcpServerWarning{
+			reason:  "ServicePortNotFound",
+			message: fmt.Sprintf("Service %v of TCPServer %v has no port %v", report.Service, getTCPServerKey(tcps), tcps.Spec.ServicePort),
+		})
+	}
+
+	if len(addresses) == 0 {
+		warnings = append(warnings, tcpServerWarning{
+			reason: "DefaultUpstream",
+			message: fmt.Sprintf("TCPServer %v has no upstream servers, NGINX proxies it to the default server on port 37: %v",
+				getTCPServerKey(tcps), report.Error),
+		})
+	}
+
+	return warnings
+}
+
+func hasServicePort(svc *corev1.Service, servicePort int) bool {
+	for _, port := range svc.Spec.Ports {
+		if int(port.Port) == servicePort {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordWarnings records the warnings of the TCPServer that weren't recorded since they last changed.
+func (c *Controller) recordWarnings(tcps *k8snginx_v1.TCPServer, warnings []tcpServerWarning) {
+	for _, warning := range c.tcpServerEvents.setWarnings(getTCPServerKey(tcps), warnings) {
+		c.recorder.Event(tcps, corev1.EventTypeWarning, warning.reason, warning.message)
+	}
+}
+
+// recordAppliedEvent records the event of the TCPServerEx applied to NGINX, if the TCPServer changed.
+func (c *Controller) recordAppliedEvent(key string, tcpServerEx *configuration.TCPServerEx) {
+	tcps := tcpServerEx.TCPServer
+
+	switch c.tcpServerEvents.setApplied(key, tcpServerEx) {
+	case tcpServerAdded:
+		c.recorder.Eventf(tcps, corev1.EventTypeNormal, "Added", "Configuration for %v was added with %d upstream servers", key, len(tcpServerEx.ServiceAddresses))
+	case tcpServerUpdated:
+		c.recorder.Eventf(tcps, corev1.EventTypeNormal, "Updated", "Configuration for %v was updated with %d upstream servers", key, len(tcpServerEx.ServiceAddresses))
+	case tcpServerUpstreamServersChanged:
+		c.recorder.Eventf(tcps, corev1.EventTypeNormal, upstreamServersChangedReason, "TCPServer %v has %d upstream servers", key, len(tcpServerEx.ServiceAddresses))
+	}
+}
+
+// recordRemovedEvent records the event of the TCPServer removed from NGINX. The event is only recorded if the TCPServer
+// still exists, for example because it was rejected, as the events of a deleted TCPServer are not shown.
+func (c *Controller) recordRemovedEvent(key string) {
+	if !c.tcpServerEvents.deleteApplied(key) {
+		return
+	}
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return
+	}
+
+	tcps, err := c.tcpServersLister.TCPServers(namespace).Get(name)
+	if err != nil {
+		return
+	}
+
+	c.recorder.Eventf(tcps, corev1.EventTypeNormal, "Removed", "Configuration for %v was removed", key)
+}
+
+// aggregateUpstreamServersEvents groups the events for the event aggregator. The events about the upstream servers of a TCPServer
+// are aggregated into a single event, with the latest message, as soon as two of them have different messages.
+// The other events are grouped by message, so that only the identical ones are aggregated.
+func aggregateUpstreamServersEvents(event *corev1.Event) (aggregateKey string, localKey string) {
+	aggregateKey, localKey = record.EventAggregatorByReasonFunc(event)
+	if event.Reason != upstreamServersChangedReason {
+		return aggregateKey + localKey, localKey
+	}
+
+	return aggregateKey, localKey
+}
+
+// eventCorrelatorOptions are the options of the event broadcaster: the events about the upstream servers are aggregated
+// from the second different message.
+var eventCorrelatorOptions = record.CorrelatorOptions{
+	KeyFunc:   aggregateUpstreamServersEvents,
+	MaxEvents: 2,
+}
@@ -0,0 +1,179 @@
+package k8s
+
+import (
+	"net"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/mohamed-gougam/kube-agent/internal/configuration"
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+func createTestTCPServerEx(listenPort int, upstreamServers int) *configuration.TCPServerEx {
+	tcpServerEx := &configuration.TCPServerEx{
+		TCPServer: &k8snginx_v1.TCPServer{
+			ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "tcps"},
+			Spec: k8snginx_v1.TCPServerSpec{
+				ListenPort:  listenPort,
+				ServiceName: "svc",
+				ServicePort: 80,
+			},
+		},
+	}
+	for i := 0; i < upstreamServers; i++ {
+		tcpServerEx.ServiceAddresses = append(tcpServerEx.ServiceAddresses, &net.TCPAddr{IP: net.IPv4(10, 0, 0, byte(i+1)), Port: 8080})
+	}
+
+	return tcpServerEx
+}
+
+func TestTCPServerEventTrackerSetApplied(t *testing.T) {
+	tracker := newTCPServerEventTracker()
+
+	tests := []struct {
+		tcpServerEx *configuration.TCPServerEx
+		expected    int
+		msg         string
+	}{
+		{
+			tcpServerEx: createTestTCPServerEx(5000, 1),
+			expected:    tcpServerAdded,
+			msg:         "new TCPServer",
+		},
+		{
+			tcpServerEx: createTestTCPServerEx(5000, 1),
+			expected:    tcpServerUnchanged,
+			msg:         "same TCPServer",
+		},
+		{
+			tcpServerEx: createTestTCPServerEx(5000, 2),
+			expected:    tcpServerUpstreamServersChanged,
+			msg:         "new endpoint",
+		},
+		{
+			tcpServerEx: createTestTCPServerEx(5001, 2),
+			expected:    tcpServerUpdated,
+			msg:         "new listen port",
+		},
+	}
+
+	for _, test := range tests {
+		result := tracker.setApplied("default/tcps", test.tcpServerEx)
+		if result != test.expected {
+			t.Errorf("setApplied() returned %v for the case of %s, expected %v", result, test.msg, test.expected)
+		}
+	}
+
+	if !tracker.deleteApplied("default/tcps") {
+		t.Errorf("deleteApplied() returned false for an applied TCPServer")
+	}
+	if tracker.deleteApplied("default/tcps") {
+		t.Errorf("deleteApplied() returned true for a removed TCPServer")
+	}
+}
+
+func TestTCPServerEventTrackerSetWarnings(t *testing.T) {
+	tracker := newTCPServerEventTracker()
+	serviceNotFound := tcpServerWarning{reason: "ServiceNotFound", message: "Service default/svc of TCPServer default/tcps doesn't exist"}
+	defaultUpstream := tcpServerWarning{reason: "DefaultUpstream", message: "TCPServer default/tcps has no upstream servers"}
+
+	newWarnings := tracker.setWarnings("default/tcps", []tcpServerWarning{serviceNotFound, defaultUpstream})
+	if len(newWarnings) != 2 {
+		t.Errorf("setWarnings() returned %v for the first warnings, expected both", newWarnings)
+	}
+
+	newWarnings = tracker.setWarnings("default/tcps", []tcpServerWarning{defaultUpstream})
+	if len(newWarnings) != 0 {
+		t.Errorf("setWarnings() returned %v for a warning already recorded, expected none", newWarnings)
+	}
+
+	tracker.setWarnings("default/tcps", nil)
+	newWarnings = tracker.setWarnings("default/tcps", []tcpServerWarning{defaultUpstream})
+	if len(newWarnings) != 1 {
+		t.Errorf("setWarnings() returned %v for a warning that was cleared, expected it again", newWarnings)
+	}
+}
+
+func TestGetEndpointsWarnings(t *testing.T) {
+	tcps := createTestEndpointsTCPServer()
+	report := &EndpointsReport{Service: "default/svc"}
+
+	tests := []struct {
+		svc       *corev1.Service
+		addresses []string
+		expected  []string
+		msg       string
+	}{
+		{
+			svc:       nil,
+			addresses: nil,
+			expected:  []string{"ServiceNotFound", "DefaultUpstream"},
+			msg:       "missing service",
+		},
+		{
+			svc: &corev1.Service{
+				Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 443}}},
+			},
+			addresses: nil,
+			expected:  []string{"ServicePortNotFound", "DefaultUpstream"},
+			msg:       "missing service port",
+		},
+		{
+			svc:       createTestService(intstr.FromInt(8080)),
+			addresses: nil,
+			expected:  []string{"DefaultUpstream"},
+			msg:       "no endpoints",
+		},
+		{
+			svc:       createTestService(intstr.FromInt(8080)),
+			addresses: []string{"10.0.0.1:8080"},
+			expected:  nil,
+			msg:       "endpoints",
+		},
+	}
+
+	for _, test := range tests {
+		warnings := getEndpointsWarnings(tcps, test.svc, test.addresses, report)
+
+		var reasons []string
+		for _, warning := range warnings {
+			reasons = append(reasons, warning.reason)
+		}
+		if len(reasons) != len(test.expected) {
+			t.Errorf("getEndpointsWarnings() returned %v for the case of %s, expected %v", reasons, test.msg, test.expected)
+			continue
+		}
+		for i := range reasons {
+			if reasons[i] != test.expected[i] {
+				t.Errorf("getEndpointsWarnings() returned %v for the case of %s, expected %v", reasons, test.msg, test.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestAggregateUpstreamServersEvents(t *testing.T) {
+	newEvent := func(reason string, message string) *corev1.Event {
+		return &corev1.Event{
+			InvolvedObject: corev1.ObjectReference{Kind: "TCPServer", Namespace: "default", Name: "tcps"},
+			Type:           corev1.EventTypeNormal,
+			Reason:         reason,
+			Message:        message,
+		}
+	}
+
+	key1, _ := aggregateUpstreamServersEvents(newEvent(upstreamServersChangedReason, "TCPServer default/tcps has 1 upstream servers"))
+	key2, _ := aggregateUpstreamServersEvents(newEvent(upstreamServersChangedReason, "TCPServer default/tcps has 2 upstream servers"))
+	if key1 != key2 {
+		t.Errorf("aggregateUpstreamServersEvents() returned different aggregate keys for the upstream servers events")
+	}
+
+	key1, _ = aggregateUpstreamServersEvents(newEvent("Rejected", "TCPServer default/tcps is invalid: a"))
+	key2, _ = aggregateUpstreamServersEvents(newEvent("Rejected", "TCPServer default/tcps is invalid: b"))
+	if key1 == key2 {
+		t.Errorf("aggregateUpstreamServersEvents() returned the same aggregate key for other events with different messages")
+	}
+}
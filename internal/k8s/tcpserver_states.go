@@ -0,0 +1,128 @@
+package k8s
+
+import (
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/mohamed-gougam/kube-agent/internal/metrics/collectors"
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+// The states of the TCPServers reported by the metrics.
+const (
+	// tcpServerStateValid means that the TCPServer is in NGINX and proxies to the endpoints of its service.
+	tcpServerStateValid = "valid"
+	// tcpServerStateNoEndpoints means that the TCPServer is in NGINX, but its service has no endpoints.
+	tcpServerStateNoEndpoints = "no-endpoints"
+	// tcpServerStateInvalid means that the TCPServer was rejected by the validation or the NGINX configuration test.
+	tcpServerStateInvalid = "invalid"
+	// tcpServerStateConflicting means that the listen port of the TCPServer is used by an older TCPServer in NGINX.
+	// It is only reported by the metrics: the TCPServer is synced like the others, whatever its state is.
+	tcpServerStateConflicting = "conflicting"
+)
+
+var tcpServerStates = []string{tcpServerStateValid, tcpServerStateNoEndpoints, tcpServerStateInvalid, tcpServerStateConflicting}
+
+// The reasons of the sync errors reported by the metrics.
+const (
+	syncErrorValidation = "validation"
+	syncErrorRender     = "render"
+	syncErrorConfig     = "config"
+	syncErrorRollback   = "rollback"
+	syncErrorWrite      = "write"
+)
+
+// tcpServerState is the state of a TCPServer, and the TCPServer it was set for.
+type tcpServerState struct {
+	tcpServer *k8snginx_v1.TCPServer
+	state     string
+}
+
+// tcpServerStateTracker keeps the state of every TCPServer and reports the number of TCPServers by state.
+type tcpServerStateTracker struct {
+	lock      sync.Mutex
+	states    map[string]tcpServerState
+	collector collectors.ControllerCollector
+}
+
+func newTCPServerStateTracker(collector collectors.ControllerCollector) *tcpServerStateTracker {
+	return &tcpServerStateTracker{
+		states:    make(map[string]tcpServerState),
+		collector: collector,
+	}
+}
+
+// setState sets the state of the TCPServer. The upstream servers of the TCPServer are only reported
+// when it is in NGINX.
+func (t *tcpServerStateTracker) setState(tcps *k8snginx_v1.TCPServer, state string, upstreamServers int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.states[getTCPServerKey(tcps)] = tcpServerState{tcpServer: tcps, state: state}
+	t.updateCounts()
+
+	if isInNginxState(state) {
+		t.collector.SetUpstreamServers(tcps.Namespace, tcps.Name, upstreamServers)
+	} else {
+		t.collector.DeleteUpstreamServers(tcps.Namespace, tcps.Name)
+	}
+}
+
+// deleteState forgets the TCPServer with the key.
+func (t *tcpServerStateTracker) deleteState(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.states, key)
+	t.updateCounts()
+
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	t.collector.DeleteUpstreamServers(namespace, name)
+}
+
+// updateCounts reports the number of TCPServers by state. A TCPServer is counted as conflicting, instead of its state,
+// if an older TCPServer in NGINX has the same listen port.
+func (t *tcpServerStateTracker) updateCounts() {
+	// the oldest TCPServer in NGINX owns the listen port
+	owners := make(map[int]*k8snginx_v1.TCPServer)
+	for _, s := range t.states {
+		if !isInNginxState(s.state) {
+			continue
+		}
+		listenPort := s.tcpServer.Spec.ListenPort
+		if owner, exists := owners[listenPort]; !exists || isOlderTCPServer(s.tcpServer, owner) {
+			owners[listenPort] = s.tcpServer
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, s := range t.states {
+		state := s.state
+		if owner, exists := owners[s.tcpServer.Spec.ListenPort]; exists && isOlderTCPServer(owner, s.tcpServer) {
+			state = tcpServerStateConflicting
+		}
+		counts[state]++
+	}
+
+	for _, state := range tcpServerStates {
+		t.collector.SetTCPServers(state, counts[state])
+	}
+}
+
+// isInNginxState checks if the TCPServer of the state is in the NGINX configuration.
+func isInNginxState(state string) bool {
+	return state == tcpServerStateValid || state == tcpServerStateNoEndpoints
+}
+
+// isOlderTCPServer checks if tcps was created before other. TCPServers created in the same second are ordered by key.
+func isOlderTCPServer(tcps *k8snginx_v1.TCPServer, other *k8snginx_v1.TCPServer) bool {
+	if !tcps.CreationTimestamp.Equal(&other.CreationTimestamp) {
+		return tcps.CreationTimestamp.Before(&other.CreationTimestamp)
+	}
+	return getTCPServerKey(tcps) < getTCPServerKey(other)
+}
+
+func getTCPServerKey(tcps *k8snginx_v1.TCPServer) string {
+	return tcps.Namespace + "/" + tcps.Name
+}
@@ -0,0 +1,106 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mohamed-gougam/kube-agent/internal/metrics/collectors"
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+type recordingCollector struct {
+	collectors.ControllerFakeCollector
+	tcpServers      map[string]int
+	upstreamServers map[string]int
+}
+
+func (rc *recordingCollector) SetTCPServers(state string, count int) {
+	rc.tcpServers[state] = count
+}
+
+func (rc *recordingCollector) SetUpstreamServers(namespace string, name string, count int) {
+	rc.upstreamServers[namespace+"/"+name] = count
+}
+
+func (rc *recordingCollector) DeleteUpstreamServers(namespace string, name string) {
+	delete(rc.upstreamServers, namespace+"/"+name)
+}
+
+func newTestTCPServer(name string, listenPort int, created time.Time) *k8snginx_v1.TCPServer {
+	return &k8snginx_v1.TCPServer{
+		ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: name, CreationTimestamp: meta_v1.NewTime(created)},
+		Spec:       k8snginx_v1.TCPServerSpec{ListenPort: listenPort},
+	}
+}
+
+func checkTCPServerCounts(t *testing.T, collector *recordingCollector, expected map[string]int, msg string) {
+	for state, count := range expected {
+		if collector.tcpServers[state] != count {
+			t.Errorf("tcpServerStateTracker reported %v TCPServers in the state %v %s, expected %v", collector.tcpServers[state], state, msg, count)
+		}
+	}
+}
+
+func TestTCPServerStateTracker(t *testing.T) {
+	collector := &recordingCollector{tcpServers: make(map[string]int), upstreamServers: make(map[string]int)}
+	tracker := newTCPServerStateTracker(collector)
+
+	now := time.Now()
+	a := newTestTCPServer("a", 5000, now.Add(-time.Hour))
+	b := newTestTCPServer("b", 5001, now)
+	c := newTestTCPServer("c", 5002, now)
+	// d uses the listen port of the older a
+	d := newTestTCPServer("d", 5000, now)
+	// e is older than f, but is not in NGINX
+	e := newTestTCPServer("e", 5003, now.Add(-time.Hour))
+	f := newTestTCPServer("f", 5003, now)
+
+	tracker.setState(a, tcpServerStateValid, 2)
+	tracker.setState(b, tcpServerStateValid, 1)
+	tracker.setState(c, tcpServerStateNoEndpoints, 0)
+	tracker.setState(b, tcpServerStateInvalid, 0)
+	tracker.deleteState("default/c")
+	tracker.setState(d, tcpServerStateValid, 3)
+	tracker.setState(e, tcpServerStateInvalid, 0)
+	tracker.setState(f, tcpServerStateValid, 1)
+
+	checkTCPServerCounts(t, collector, map[string]int{
+		tcpServerStateValid:       2,
+		tcpServerStateNoEndpoints: 0,
+		tcpServerStateInvalid:     2,
+		tcpServerStateConflicting: 1,
+	}, "with a conflicting TCPServer")
+
+	// the conflicting TCPServer is still in NGINX
+	expectedUpstreamServers := map[string]int{"default/a": 2, "default/d": 3, "default/f": 1}
+	if !reflect.DeepEqual(collector.upstreamServers, expectedUpstreamServers) {
+		t.Errorf("tcpServerStateTracker reported the upstream servers %v, expected %v", collector.upstreamServers, expectedUpstreamServers)
+	}
+
+	// d owns the listen port once a is removed
+	tracker.deleteState("default/a")
+
+	checkTCPServerCounts(t, collector, map[string]int{
+		tcpServerStateValid:       2,
+		tcpServerStateInvalid:     2,
+		tcpServerStateConflicting: 0,
+	}, "after the owner of the listen port was removed")
+}
+
+func TestIsOlderTCPServer(t *testing.T) {
+	now := time.Now()
+
+	older := newTestTCPServer("b", 5000, now.Add(-time.Minute))
+	newer := newTestTCPServer("a", 5000, now)
+	if !isOlderTCPServer(older, newer) || isOlderTCPServer(newer, older) {
+		t.Errorf("isOlderTCPServer() didn't order the TCPServers by creation time")
+	}
+
+	sameTime := newTestTCPServer("b", 5000, now)
+	if !isOlderTCPServer(newer, sameTime) || isOlderTCPServer(sameTime, newer) {
+		t.Errorf("isOlderTCPServer() didn't order the TCPServers created at the same time by key")
+	}
+}
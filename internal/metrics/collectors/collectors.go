@@ -1,3 +1,3 @@
 package collectors
 
-const metricsNamespace = "nginx_ingress_controller"
+const metricsNamespace = "kube_agent"
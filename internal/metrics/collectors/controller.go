@@ -1,95 +1,141 @@
 package collectors
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"sync"
+	"time"
 
-var labelNamesController = []string{"type"}
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 // ControllerCollector is an interface for the metrics of the Controller
 type ControllerCollector interface {
-	SetIngresses(ingressType string, count int)
-	SetVirtualServers(count int)
-	SetVirtualServerRoutes(count int)
+	SetTCPServers(state string, count int)
+	SetUpstreamServers(namespace string, name string, count int)
+	DeleteUpstreamServers(namespace string, name string)
+	IncSyncErrors(reason string)
+	UpdateLastSuccessfulSync(t time.Time)
+	ObserveEventToLiveLatency(resource string, latency time.Duration)
 	Register(registry *prometheus.Registry) error
 }
 
 // ControllerMetricsCollector implements the ControllerCollector interface and prometheus.Collector interface
 type ControllerMetricsCollector struct {
-	crdsEnabled              bool
-	ingressesTotal           *prometheus.GaugeVec
-	virtualServersTotal      prometheus.Gauge
-	virtualServerRoutesTotal prometheus.Gauge
+	tcpServersTotal         *prometheus.GaugeVec
+	upstreamServers         *prometheus.GaugeVec
+	syncErrorsTotal         *prometheus.CounterVec
+	sinceLastSuccessfulSync prometheus.GaugeFunc
+	eventToLiveLatency      *prometheus.HistogramVec
+	lastSyncLock            sync.Mutex
+	lastSuccessfulSync      time.Time
 }
 
 // NewControllerMetricsCollector creates a new ControllerMetricsCollector
-func NewControllerMetricsCollector(crdsEnabled bool) *ControllerMetricsCollector {
-	ingResTotal := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:      "ingress_resources_total",
-			Namespace: metricsNamespace,
-			Help:      "Number of handled ingress resources",
-		},
-		labelNamesController,
-	)
-
-	if !crdsEnabled {
-		return &ControllerMetricsCollector{ingressesTotal: ingResTotal}
+func NewControllerMetricsCollector() *ControllerMetricsCollector {
+	cc := &ControllerMetricsCollector{
+		tcpServersTotal: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      "tcpserver_resources_total",
+				Namespace: metricsNamespace,
+				Help:      "Number of handled TCPServer resources by state",
+			},
+			[]string{"state"},
+		),
+		upstreamServers: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      "tcpserver_upstream_servers",
+				Namespace: metricsNamespace,
+				Help:      "Number of upstream servers of a TCPServer",
+			},
+			[]string{"namespace", "name"},
+		),
+		syncErrorsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:      "tcpserver_sync_errors_total",
+				Namespace: metricsNamespace,
+				Help:      "Number of errors syncing TCPServers to NGINX by reason",
+			},
+			[]string{"reason"},
+		),
+		eventToLiveLatency: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:      "event_to_live_latency_seconds",
+				Namespace: metricsNamespace,
+				Help:      "Seconds from the informer event of a TCPServer, its Endpoints or the ConfigMap to NGINX running the updated configuration",
+				Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+			},
+			[]string{"resource"},
+		),
+		lastSuccessfulSync: time.Now(),
 	}
 
-	vsResTotal := prometheus.NewGauge(
+	cc.sinceLastSuccessfulSync = prometheus.NewGaugeFunc(
 		prometheus.GaugeOpts{
-			Name:      "virtualserver_resources_total",
+			Name:      "seconds_since_last_successful_sync",
 			Namespace: metricsNamespace,
-			Help:      "Number of handled VirtualServer resources",
+			Help:      "Seconds since the last TCPServer or ConfigMap was successfully synced to NGINX, or since the agent started",
 		},
+		cc.getSecondsSinceLastSuccessfulSync,
 	)
 
-	vsrResTotal := prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name:      "virtualserverroute_resources_total",
-			Namespace: metricsNamespace,
-			Help:      "Number of handled VirtualServerRoute resources",
-		},
-	)
+	return cc
+}
 
-	return &ControllerMetricsCollector{
-		crdsEnabled:              true,
-		ingressesTotal:           ingResTotal,
-		virtualServersTotal:      vsResTotal,
-		virtualServerRoutesTotal: vsrResTotal,
-	}
+// SetTCPServers sets the value of the TCPServer resources gauge for a given state
+func (cc *ControllerMetricsCollector) SetTCPServers(state string, count int) {
+	cc.tcpServersTotal.WithLabelValues(state).Set(float64(count))
 }
 
-// SetIngresses sets the value of the ingress resources gauge for a given type
-func (cc *ControllerMetricsCollector) SetIngresses(ingressType string, count int) {
-	cc.ingressesTotal.WithLabelValues(ingressType).Set(float64(count))
+// SetUpstreamServers sets the number of upstream servers of a TCPServer
+func (cc *ControllerMetricsCollector) SetUpstreamServers(namespace string, name string, count int) {
+	cc.upstreamServers.WithLabelValues(namespace, name).Set(float64(count))
 }
 
-// SetVirtualServers sets the value of the VirtualServer resources gauge
-func (cc *ControllerMetricsCollector) SetVirtualServers(count int) {
-	cc.virtualServersTotal.Set(float64(count))
+// DeleteUpstreamServers removes the upstream servers gauge of a TCPServer that is no longer in NGINX
+func (cc *ControllerMetricsCollector) DeleteUpstreamServers(namespace string, name string) {
+	cc.upstreamServers.DeleteLabelValues(namespace, name)
 }
 
-// SetVirtualServerRoutes sets the value of the VirtualServerRoute resources gauge
-func (cc *ControllerMetricsCollector) SetVirtualServerRoutes(count int) {
-	cc.virtualServerRoutesTotal.Set(float64(count))
+// IncSyncErrors increments the counter of sync errors for a given reason
+func (cc *ControllerMetricsCollector) IncSyncErrors(reason string) {
+	cc.syncErrorsTotal.WithLabelValues(reason).Inc()
+}
+
+// UpdateLastSuccessfulSync updates the time of the last successful sync
+func (cc *ControllerMetricsCollector) UpdateLastSuccessfulSync(t time.Time) {
+	cc.lastSyncLock.Lock()
+	defer cc.lastSyncLock.Unlock()
+
+	cc.lastSuccessfulSync = t
+}
+
+// ObserveEventToLiveLatency observes the latency from an informer event to NGINX running the updated configuration
+func (cc *ControllerMetricsCollector) ObserveEventToLiveLatency(resource string, latency time.Duration) {
+	cc.eventToLiveLatency.WithLabelValues(resource).Observe(latency.Seconds())
+}
+
+func (cc *ControllerMetricsCollector) getSecondsSinceLastSuccessfulSync() float64 {
+	cc.lastSyncLock.Lock()
+	defer cc.lastSyncLock.Unlock()
+
+	return time.Since(cc.lastSuccessfulSync).Seconds()
 }
 
 // Describe implements prometheus.Collector interface Describe method
 func (cc *ControllerMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
-	cc.ingressesTotal.Describe(ch)
-	if cc.crdsEnabled {
-		cc.virtualServersTotal.Describe(ch)
-		cc.virtualServerRoutesTotal.Describe(ch)
-	}
+	cc.tcpServersTotal.Describe(ch)
+	cc.upstreamServers.Describe(ch)
+	cc.syncErrorsTotal.Describe(ch)
+	cc.sinceLastSuccessfulSync.Describe(ch)
+	cc.eventToLiveLatency.Describe(ch)
 }
 
 // Collect implements the prometheus.Collector interface Collect method
 func (cc *ControllerMetricsCollector) Collect(ch chan<- prometheus.Metric) {
-	cc.ingressesTotal.Collect(ch)
-	if cc.crdsEnabled {
-		cc.virtualServersTotal.Collect(ch)
-		cc.virtualServerRoutesTotal.Collect(ch)
-	}
+	cc.tcpServersTotal.Collect(ch)
+	cc.upstreamServers.Collect(ch)
+	cc.syncErrorsTotal.Collect(ch)
+	cc.sinceLastSuccessfulSync.Collect(ch)
+	cc.eventToLiveLatency.Collect(ch)
 }
 
 // Register registers all the metrics of the collector
@@ -108,11 +154,21 @@ func NewControllerFakeCollector() *ControllerFakeCollector {
 // Register implements a fake Register
 func (cc *ControllerFakeCollector) Register(registry *prometheus.Registry) error { return nil }
 
-// SetIngresses implements a fake SetIngresses
-func (cc *ControllerFakeCollector) SetIngresses(ingressType string, count int) {}
+// SetTCPServers implements a fake SetTCPServers
+func (cc *ControllerFakeCollector) SetTCPServers(state string, count int) {}
+
+// SetUpstreamServers implements a fake SetUpstreamServers
+func (cc *ControllerFakeCollector) SetUpstreamServers(namespace string, name string, count int) {}
 
-// SetVirtualServers implements a fake SetVirtualServers
-func (cc *ControllerFakeCollector) SetVirtualServers(count int) {}
+// DeleteUpstreamServers implements a fake DeleteUpstreamServers
+func (cc *ControllerFakeCollector) DeleteUpstreamServers(namespace string, name string) {}
 
-// SetVirtualServerRoutes implements a fake SetVirtualServerRoutes
-func (cc *ControllerFakeCollector) SetVirtualServerRoutes(count int) {}
+// IncSyncErrors implements a fake IncSyncErrors
+func (cc *ControllerFakeCollector) IncSyncErrors(reason string) {}
+
+// UpdateLastSuccessfulSync implements a fake UpdateLastSuccessfulSync
+func (cc *ControllerFakeCollector) UpdateLastSuccessfulSync(t time.Time) {}
+
+// ObserveEventToLiveLatency implements a fake ObserveEventToLiveLatency
+func (cc *ControllerFakeCollector) ObserveEventToLiveLatency(resource string, latency time.Duration) {
+}
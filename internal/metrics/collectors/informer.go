@@ -0,0 +1,109 @@
+package collectors
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const informerSubsystem = "informer"
+
+// The types of the informer events. A resync is an update event with an unchanged object, sent by the informer
+// from its cache rather than from the API watch.
+const (
+	InformerEventAdd    = "add"
+	InformerEventUpdate = "update"
+	InformerEventDelete = "delete"
+	InformerEventResync = "resync"
+)
+
+// InformerCollector is an interface for the metrics of the informers
+type InformerCollector interface {
+	ObserveEvent(resource string, eventType string)
+	Register(registry *prometheus.Registry) error
+}
+
+// InformerMetricsCollector implements the InformerCollector interface and prometheus.Collector interface
+type InformerMetricsCollector struct {
+	eventsTotal    *prometheus.CounterVec
+	lastEventTime  *prometheus.GaugeVec
+	lastResyncTime *prometheus.GaugeVec
+}
+
+// NewInformerMetricsCollector creates a new InformerMetricsCollector
+func NewInformerMetricsCollector() *InformerMetricsCollector {
+	return &InformerMetricsCollector{
+		eventsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:      "events_total",
+				Namespace: metricsNamespace,
+				Subsystem: informerSubsystem,
+				Help:      "Number of events received by the informer of a resource by type",
+			},
+			[]string{"resource", "type"},
+		),
+		lastEventTime: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      "last_event_timestamp_seconds",
+				Namespace: metricsNamespace,
+				Subsystem: informerSubsystem,
+				Help:      "Unix time of the last add, update or delete event received from the API watch by the informer of a resource",
+			},
+			[]string{"resource"},
+		),
+		lastResyncTime: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      "last_resync_timestamp_seconds",
+				Namespace: metricsNamespace,
+				Subsystem: informerSubsystem,
+				Help:      "Unix time of the last resync of the informer of a resource",
+			},
+			[]string{"resource"},
+		),
+	}
+}
+
+// ObserveEvent counts an event of the informer of the resource and updates the time of its last event or resync
+func (ic *InformerMetricsCollector) ObserveEvent(resource string, eventType string) {
+	ic.eventsTotal.WithLabelValues(resource, eventType).Inc()
+
+	now := float64(time.Now().UnixNano()) / float64(time.Second)
+	if eventType == InformerEventResync {
+		ic.lastResyncTime.WithLabelValues(resource).Set(now)
+		return
+	}
+	ic.lastEventTime.WithLabelValues(resource).Set(now)
+}
+
+// Describe implements prometheus.Collector interface Describe method
+func (ic *InformerMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ic.eventsTotal.Describe(ch)
+	ic.lastEventTime.Describe(ch)
+	ic.lastResyncTime.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface Collect method
+func (ic *InformerMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	ic.eventsTotal.Collect(ch)
+	ic.lastEventTime.Collect(ch)
+	ic.lastResyncTime.Collect(ch)
+}
+
+// Register registers all the metrics of the collector
+func (ic *InformerMetricsCollector) Register(registry *prometheus.Registry) error {
+	return registry.Register(ic)
+}
+
+// InformerFakeCollector is a fake collector that implements the InformerCollector interface
+type InformerFakeCollector struct{}
+
+// NewInformerFakeCollector creates a fake collector that implements the InformerCollector interface
+func NewInformerFakeCollector() *InformerFakeCollector {
+	return &InformerFakeCollector{}
+}
+
+// Register implements a fake Register
+func (ic *InformerFakeCollector) Register(registry *prometheus.Registry) error { return nil }
+
+// ObserveEvent implements a fake ObserveEvent
+func (ic *InformerFakeCollector) ObserveEvent(resource string, eventType string) {}
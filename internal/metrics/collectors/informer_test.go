@@ -0,0 +1,57 @@
+package collectors
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInformerMetricsCollector(t *testing.T) {
+	ic := NewInformerMetricsCollector()
+
+	ic.ObserveEvent("tcpservers", InformerEventAdd)
+	ic.ObserveEvent("tcpservers", InformerEventAdd)
+	ic.ObserveEvent("tcpservers", InformerEventResync)
+	ic.ObserveEvent("services", InformerEventDelete)
+
+	expected := `
+# HELP kube_agent_informer_events_total Number of events received by the informer of a resource by type
+# TYPE kube_agent_informer_events_total counter
+kube_agent_informer_events_total{resource="services",type="delete"} 1
+kube_agent_informer_events_total{resource="tcpservers",type="add"} 2
+kube_agent_informer_events_total{resource="tcpservers",type="resync"} 1
+`
+	if err := testutil.CollectAndCompare(ic, strings.NewReader(expected), "kube_agent_informer_events_total"); err != nil {
+		t.Errorf("the informer events metrics are not the expected ones: %v", err)
+	}
+
+	tests := []struct {
+		resource           string
+		expectedLastEvent  bool
+		expectedLastResync bool
+	}{
+		{
+			resource:           "tcpservers",
+			expectedLastEvent:  true,
+			expectedLastResync: true,
+		},
+		{
+			resource:           "services",
+			expectedLastEvent:  true,
+			expectedLastResync: false,
+		},
+	}
+
+	for _, test := range tests {
+		lastEvent := testutil.ToFloat64(ic.lastEventTime.WithLabelValues(test.resource)) > 0
+		if lastEvent != test.expectedLastEvent {
+			t.Errorf("the time of the last event of %v is set %v, expected %v", test.resource, lastEvent, test.expectedLastEvent)
+		}
+
+		lastResync := testutil.ToFloat64(ic.lastResyncTime.WithLabelValues(test.resource)) > 0
+		if lastResync != test.expectedLastResync {
+			t.Errorf("the time of the last resync of %v is set %v, expected %v", test.resource, lastResync, test.expectedLastResync)
+		}
+	}
+}
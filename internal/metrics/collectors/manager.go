@@ -10,6 +10,8 @@ import (
 type ManagerCollector interface {
 	IncNginxReloadCount()
 	IncNginxReloadErrors()
+	IncNginxRollbacks()
+	IncNginxRestarts()
 	UpdateLastReloadTime(ms time.Duration)
 	Register(registry *prometheus.Registry) error
 }
@@ -19,8 +21,11 @@ type LocalManagerMetricsCollector struct {
 	// Metrics
 	reloadsTotal     prometheus.Counter
 	reloadsError     prometheus.Counter
+	rollbacksTotal   prometheus.Counter
+	restartsTotal    prometheus.Counter
 	lastReloadStatus prometheus.Gauge
 	lastReloadTime   prometheus.Gauge
+	reloadDuration   prometheus.Histogram
 }
 
 // NewLocalManagerMetricsCollector creates a new LocalManagerMetricsCollector
@@ -40,6 +45,20 @@ func NewLocalManagerMetricsCollector() *LocalManagerMetricsCollector {
 				Help:      "Number of unsuccessful NGINX reloads",
 			},
 		),
+		rollbacksTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name:      "nginx_rollbacks_total",
+				Namespace: metricsNamespace,
+				Help:      "Number of rollbacks to the last good NGINX configuration after a failed reload",
+			},
+		),
+		restartsTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name:      "nginx_restarts_total",
+				Namespace: metricsNamespace,
+				Help:      "Number of restarts of NGINX after it exited unexpectedly",
+			},
+		),
 		lastReloadStatus: prometheus.NewGauge(
 			prometheus.GaugeOpts{
 				Name:      "nginx_last_reload_status",
@@ -54,6 +73,14 @@ func NewLocalManagerMetricsCollector() *LocalManagerMetricsCollector {
 				Help:      "Duration in milliseconds of the last NGINX reload",
 			},
 		),
+		reloadDuration: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:      "nginx_reload_duration_seconds",
+				Namespace: metricsNamespace,
+				Help:      "Duration in seconds of the NGINX reloads, until the workers run the new configuration version",
+				Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+			},
+		),
 	}
 	return nc
 }
@@ -70,6 +97,16 @@ func (nc *LocalManagerMetricsCollector) IncNginxReloadErrors() {
 	nc.updateLastReloadStatus(false)
 }
 
+// IncNginxRollbacks increments the counter of rollbacks to the last good NGINX configuration
+func (nc *LocalManagerMetricsCollector) IncNginxRollbacks() {
+	nc.rollbacksTotal.Inc()
+}
+
+// IncNginxRestarts increments the counter of restarts of NGINX
+func (nc *LocalManagerMetricsCollector) IncNginxRestarts() {
+	nc.restartsTotal.Inc()
+}
+
 // updateLastReloadStatus updates the last NGINX reload status metric
 func (nc *LocalManagerMetricsCollector) updateLastReloadStatus(up bool) {
 	var status float64
@@ -79,25 +116,32 @@ func (nc *LocalManagerMetricsCollector) updateLastReloadStatus(up bool) {
 	nc.lastReloadStatus.Set(status)
 }
 
-// UpdateLastReloadTime updates the last NGINX reload time
+// UpdateLastReloadTime updates the last NGINX reload time and observes it in the reload duration histogram
 func (nc *LocalManagerMetricsCollector) UpdateLastReloadTime(duration time.Duration) {
 	nc.lastReloadTime.Set(float64(duration / time.Millisecond))
+	nc.reloadDuration.Observe(duration.Seconds())
 }
 
 // Describe implements prometheus.Collector interface Describe method
 func (nc *LocalManagerMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
 	nc.reloadsTotal.Describe(ch)
 	nc.reloadsError.Describe(ch)
+	nc.rollbacksTotal.Describe(ch)
+	nc.restartsTotal.Describe(ch)
 	nc.lastReloadStatus.Describe(ch)
 	nc.lastReloadTime.Describe(ch)
+	nc.reloadDuration.Describe(ch)
 }
 
 // Collect implements the prometheus.Collector interface Collect method
 func (nc *LocalManagerMetricsCollector) Collect(ch chan<- prometheus.Metric) {
 	nc.reloadsTotal.Collect(ch)
 	nc.reloadsError.Collect(ch)
+	nc.rollbacksTotal.Collect(ch)
+	nc.restartsTotal.Collect(ch)
 	nc.lastReloadStatus.Collect(ch)
 	nc.lastReloadTime.Collect(ch)
+	nc.reloadDuration.Collect(ch)
 }
 
 // Register registers all the metrics of the collector
@@ -124,3 +168,9 @@ func (nc *ManagerFakeCollector) IncNginxReloadErrors() {}
 
 // UpdateLastReloadTime implements a fake UpdateLastReloadTime
 func (nc *ManagerFakeCollector) UpdateLastReloadTime(ms time.Duration) {}
+
+// IncNginxRollbacks implements a fake IncNginxRollbacks
+func (nc *ManagerFakeCollector) IncNginxRollbacks() {}
+
+// IncNginxRestarts implements a fake IncNginxRestarts
+func (nc *ManagerFakeCollector) IncNginxRestarts() {}
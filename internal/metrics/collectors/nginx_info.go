@@ -0,0 +1,57 @@
+package collectors
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// NginxInfoCollector exposes the capabilities of the NGINX binary detected at startup.
+// It implements the prometheus.Collector interface.
+type NginxInfoCollector struct {
+	info    *prometheus.GaugeVec
+	modules *prometheus.GaugeVec
+}
+
+// NewNginxInfoCollector creates a new NginxInfoCollector for the NGINX version, Plus release and modules.
+func NewNginxInfoCollector(version string, plusRelease string, modules []string) *NginxInfoCollector {
+	info := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "nginx_info",
+			Namespace: metricsNamespace,
+			Help:      "Version of NGINX, the plus_release label is empty for NGINX OSS",
+		},
+		[]string{"version", "plus_release"},
+	)
+	info.WithLabelValues(version, plusRelease).Set(1)
+
+	moduleInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "nginx_module_info",
+			Namespace: metricsNamespace,
+			Help:      "Modules compiled into NGINX",
+		},
+		[]string{"module"},
+	)
+	for _, module := range modules {
+		moduleInfo.WithLabelValues(module).Set(1)
+	}
+
+	return &NginxInfoCollector{
+		info:    info,
+		modules: moduleInfo,
+	}
+}
+
+// Describe implements prometheus.Collector interface Describe method
+func (ic *NginxInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ic.info.Describe(ch)
+	ic.modules.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface Collect method
+func (ic *NginxInfoCollector) Collect(ch chan<- prometheus.Metric) {
+	ic.info.Collect(ch)
+	ic.modules.Collect(ch)
+}
+
+// Register registers all the metrics of the collector
+func (ic *NginxInfoCollector) Register(registry *prometheus.Registry) error {
+	return registry.Register(ic)
+}
@@ -0,0 +1,161 @@
+package collectors
+
+import (
+	"github.com/nginxinc/nginx-plus-go-client/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// upstreamServerStates are the states of the servers of a stream upstream in NGINX Plus.
+var upstreamServerStates = []string{"up", "draining", "down", "unavail", "checking", "unhealthy"}
+
+// PlusStatsClient gets the statistics of NGINX Plus.
+type PlusStatsClient interface {
+	GetStats() (*client.Stats, error)
+}
+
+// TCPServerZonesGetter returns the TCPServers in NGINX, by the name of the zones of their server and upstream in NGINX Plus.
+type TCPServerZonesGetter func() map[string]types.NamespacedName
+
+// TCPServerStreamCollector exposes the statistics of the stream server and upstream zones of the TCPServers in NGINX Plus,
+// labeled with the namespace and the name of the TCPServers. The zones of NGINX Plus that don't belong to a TCPServer are ignored.
+// It implements the prometheus.Collector interface.
+type TCPServerStreamCollector struct {
+	client   PlusStatsClient
+	getZones TCPServerZonesGetter
+
+	connections    *prometheus.Desc
+	activeSessions *prometheus.Desc
+	sessions       *prometheus.Desc
+	discarded      *prometheus.Desc
+	received       *prometheus.Desc
+	sent           *prometheus.Desc
+
+	serverState             *prometheus.Desc
+	serverActive            *prometheus.Desc
+	serverConnections       *prometheus.Desc
+	serverReceived          *prometheus.Desc
+	serverSent              *prometheus.Desc
+	serverFails             *prometheus.Desc
+	serverUnavail           *prometheus.Desc
+	serverHealthChecks      *prometheus.Desc
+	serverHealthCheckFails  *prometheus.Desc
+	serverUnhealthy         *prometheus.Desc
+	serverHealthCheckPassed *prometheus.Desc
+}
+
+func newTCPServerDesc(name string, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "tcpserver", name),
+		help,
+		append([]string{"namespace", "name"}, labels...),
+		nil,
+	)
+}
+
+// NewTCPServerStreamCollector creates a new TCPServerStreamCollector. getZones maps the zones to the TCPServers on every scrape.
+func NewTCPServerStreamCollector(client PlusStatsClient, getZones TCPServerZonesGetter) *TCPServerStreamCollector {
+	return &TCPServerStreamCollector{
+		client:   client,
+		getZones: getZones,
+
+		connections:    newTCPServerDesc("connections_total", "Number of client connections accepted by a TCPServer"),
+		activeSessions: newTCPServerDesc("active_sessions", "Number of client connections of a TCPServer currently being processed"),
+		sessions:       newTCPServerDesc("sessions_total", "Number of completed sessions of a TCPServer by status code class", "code"),
+		discarded:      newTCPServerDesc("discarded_total", "Number of client connections of a TCPServer completed without creating a session"),
+		received:       newTCPServerDesc("received_bytes_total", "Number of bytes received from the clients of a TCPServer"),
+		sent:           newTCPServerDesc("sent_bytes_total", "Number of bytes sent to the clients of a TCPServer"),
+
+		serverState:             newTCPServerDesc("upstream_server_state", "State of an upstream server of a TCPServer, 1 for the current state", "server", "state"),
+		serverActive:            newTCPServerDesc("upstream_server_active_connections", "Number of active connections to an upstream server of a TCPServer", "server"),
+		serverConnections:       newTCPServerDesc("upstream_server_connections_total", "Number of client connections forwarded to an upstream server of a TCPServer", "server"),
+		serverReceived:          newTCPServerDesc("upstream_server_received_bytes_total", "Number of bytes received from an upstream server of a TCPServer", "server"),
+		serverSent:              newTCPServerDesc("upstream_server_sent_bytes_total", "Number of bytes sent to an upstream server of a TCPServer", "server"),
+		serverFails:             newTCPServerDesc("upstream_server_fails_total", "Number of failed attempts to communicate with an upstream server of a TCPServer", "server"),
+		serverUnavail:           newTCPServerDesc("upstream_server_unavailable_total", "Number of times an upstream server of a TCPServer became unavailable because of failed attempts", "server"),
+		serverHealthChecks:      newTCPServerDesc("upstream_server_health_checks_total", "Number of health checks of an upstream server of a TCPServer", "server"),
+		serverHealthCheckFails:  newTCPServerDesc("upstream_server_health_checks_fails_total", "Number of failed health checks of an upstream server of a TCPServer", "server"),
+		serverUnhealthy:         newTCPServerDesc("upstream_server_unhealthy_total", "Number of times an upstream server of a TCPServer became unhealthy", "server"),
+		serverHealthCheckPassed: newTCPServerDesc("upstream_server_health_check_last_passed", "Whether the last health check of an upstream server of a TCPServer passed", "server"),
+	}
+}
+
+// Describe implements prometheus.Collector interface Describe method
+func (sc *TCPServerStreamCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		sc.connections, sc.activeSessions, sc.sessions, sc.discarded, sc.received, sc.sent,
+		sc.serverState, sc.serverActive, sc.serverConnections, sc.serverReceived, sc.serverSent, sc.serverFails,
+		sc.serverUnavail, sc.serverHealthChecks, sc.serverHealthCheckFails, sc.serverUnhealthy, sc.serverHealthCheckPassed,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements the prometheus.Collector interface Collect method
+func (sc *TCPServerStreamCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := sc.client.GetStats()
+	if err != nil {
+		klog.ErrorS(err, "Error getting the stats of NGINX Plus for the TCPServer metrics")
+		return
+	}
+
+	zones := sc.getZones()
+
+	for zone, serverZone := range stats.StreamServerZones {
+		tcpServer, exists := zones[zone]
+		if !exists {
+			continue
+		}
+		labels := []string{tcpServer.Namespace, tcpServer.Name}
+
+		ch <- prometheus.MustNewConstMetric(sc.connections, prometheus.CounterValue, float64(serverZone.Connections), labels...)
+		ch <- prometheus.MustNewConstMetric(sc.activeSessions, prometheus.GaugeValue, float64(serverZone.Processing), labels...)
+		ch <- prometheus.MustNewConstMetric(sc.sessions, prometheus.CounterValue, float64(serverZone.Sessions.Sessions2xx), append(labels, "2xx")...)
+		ch <- prometheus.MustNewConstMetric(sc.sessions, prometheus.CounterValue, float64(serverZone.Sessions.Sessions4xx), append(labels, "4xx")...)
+		ch <- prometheus.MustNewConstMetric(sc.sessions, prometheus.CounterValue, float64(serverZone.Sessions.Sessions5xx), append(labels, "5xx")...)
+		ch <- prometheus.MustNewConstMetric(sc.discarded, prometheus.CounterValue, float64(serverZone.Discarded), labels...)
+		ch <- prometheus.MustNewConstMetric(sc.received, prometheus.CounterValue, float64(serverZone.Received), labels...)
+		ch <- prometheus.MustNewConstMetric(sc.sent, prometheus.CounterValue, float64(serverZone.Sent), labels...)
+	}
+
+	for name, upstream := range stats.StreamUpstreams {
+		tcpServer, exists := zones[name]
+		if !exists {
+			continue
+		}
+
+		for _, peer := range upstream.Peers {
+			labels := []string{tcpServer.Namespace, tcpServer.Name, peer.Server}
+
+			for _, state := range upstreamServerStates {
+				var value float64
+				if peer.State == state {
+					value = 1
+				}
+				ch <- prometheus.MustNewConstMetric(sc.serverState, prometheus.GaugeValue, value, append(labels, state)...)
+			}
+
+			var lastPassed float64
+			if peer.HealthChecks.LastPassed {
+				lastPassed = 1
+			}
+
+			ch <- prometheus.MustNewConstMetric(sc.serverActive, prometheus.GaugeValue, float64(peer.Active), labels...)
+			ch <- prometheus.MustNewConstMetric(sc.serverConnections, prometheus.CounterValue, float64(peer.Connections), labels...)
+			ch <- prometheus.MustNewConstMetric(sc.serverReceived, prometheus.CounterValue, float64(peer.Received), labels...)
+			ch <- prometheus.MustNewConstMetric(sc.serverSent, prometheus.CounterValue, float64(peer.Sent), labels...)
+			ch <- prometheus.MustNewConstMetric(sc.serverFails, prometheus.CounterValue, float64(peer.Fails), labels...)
+			ch <- prometheus.MustNewConstMetric(sc.serverUnavail, prometheus.CounterValue, float64(peer.Unavail), labels...)
+			ch <- prometheus.MustNewConstMetric(sc.serverHealthChecks, prometheus.CounterValue, float64(peer.HealthChecks.Checks), labels...)
+			ch <- prometheus.MustNewConstMetric(sc.serverHealthCheckFails, prometheus.CounterValue, float64(peer.HealthChecks.Fails), labels...)
+			ch <- prometheus.MustNewConstMetric(sc.serverUnhealthy, prometheus.CounterValue, float64(peer.HealthChecks.Unhealthy), labels...)
+			ch <- prometheus.MustNewConstMetric(sc.serverHealthCheckPassed, prometheus.GaugeValue, lastPassed, labels...)
+		}
+	}
+}
+
+// Register registers all the metrics of the collector
+func (sc *TCPServerStreamCollector) Register(registry *prometheus.Registry) error {
+	return registry.Register(sc)
+}
@@ -0,0 +1,123 @@
+package collectors
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nginxinc/nginx-plus-go-client/client"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type fakePlusStatsClient struct {
+	stats *client.Stats
+	err   error
+}
+
+func (c *fakePlusStatsClient) GetStats() (*client.Stats, error) {
+	return c.stats, c.err
+}
+
+func TestTCPServerStreamCollector(t *testing.T) {
+	stats := &client.Stats{
+		StreamServerZones: client.StreamServerZones{
+			"ts_default_coffee": client.StreamServerZone{
+				Processing:  2,
+				Connections: 10,
+				Sessions: client.Sessions{
+					Sessions2xx: 7,
+					Sessions4xx: 0,
+					Sessions5xx: 1,
+				},
+				Received: 100,
+				Sent:     200,
+			},
+			// a server of the main config, not of a TCPServer
+			"dns": client.StreamServerZone{
+				Connections: 5,
+			},
+		},
+		StreamUpstreams: client.StreamUpstreams{
+			"ts_default_coffee": client.StreamUpstream{
+				Peers: []client.StreamPeer{
+					{
+						Server:      "10.0.0.1:5000",
+						State:       "unhealthy",
+						Active:      1,
+						Connections: 8,
+						Fails:       3,
+					},
+				},
+			},
+			"dns": client.StreamUpstream{
+				Peers: []client.StreamPeer{
+					{
+						Server: "10.0.0.10:53",
+						State:  "up",
+					},
+				},
+			},
+		},
+	}
+
+	zones := map[string]types.NamespacedName{
+		"ts_default_coffee": {Namespace: "default", Name: "coffee"},
+	}
+
+	tests := []struct {
+		client      *fakePlusStatsClient
+		metricNames []string
+		expected    string
+		msg         string
+	}{
+		{
+			client: &fakePlusStatsClient{stats: stats},
+			metricNames: []string{
+				"kube_agent_tcpserver_connections_total",
+				"kube_agent_tcpserver_sessions_total",
+				"kube_agent_tcpserver_upstream_server_connections_total",
+				"kube_agent_tcpserver_upstream_server_state",
+			},
+			expected: `
+# HELP kube_agent_tcpserver_connections_total Number of client connections accepted by a TCPServer
+# TYPE kube_agent_tcpserver_connections_total counter
+kube_agent_tcpserver_connections_total{name="coffee",namespace="default"} 10
+# HELP kube_agent_tcpserver_sessions_total Number of completed sessions of a TCPServer by status code class
+# TYPE kube_agent_tcpserver_sessions_total counter
+kube_agent_tcpserver_sessions_total{code="2xx",name="coffee",namespace="default"} 7
+kube_agent_tcpserver_sessions_total{code="4xx",name="coffee",namespace="default"} 0
+kube_agent_tcpserver_sessions_total{code="5xx",name="coffee",namespace="default"} 1
+# HELP kube_agent_tcpserver_upstream_server_connections_total Number of client connections forwarded to an upstream server of a TCPServer
+# TYPE kube_agent_tcpserver_upstream_server_connections_total counter
+kube_agent_tcpserver_upstream_server_connections_total{name="coffee",namespace="default",server="10.0.0.1:5000"} 8
+# HELP kube_agent_tcpserver_upstream_server_state State of an upstream server of a TCPServer, 1 for the current state
+# TYPE kube_agent_tcpserver_upstream_server_state gauge
+kube_agent_tcpserver_upstream_server_state{name="coffee",namespace="default",server="10.0.0.1:5000",state="checking"} 0
+kube_agent_tcpserver_upstream_server_state{name="coffee",namespace="default",server="10.0.0.1:5000",state="down"} 0
+kube_agent_tcpserver_upstream_server_state{name="coffee",namespace="default",server="10.0.0.1:5000",state="draining"} 0
+kube_agent_tcpserver_upstream_server_state{name="coffee",namespace="default",server="10.0.0.1:5000",state="unavail"} 0
+kube_agent_tcpserver_upstream_server_state{name="coffee",namespace="default",server="10.0.0.1:5000",state="unhealthy"} 1
+kube_agent_tcpserver_upstream_server_state{name="coffee",namespace="default",server="10.0.0.1:5000",state="up"} 0
+`,
+			msg: "the zones of a TCPServer and of the main config",
+		},
+		{
+			client: &fakePlusStatsClient{err: errors.New("connection refused")},
+			metricNames: []string{
+				"kube_agent_tcpserver_connections_total",
+				"kube_agent_tcpserver_upstream_server_state",
+			},
+			expected: "",
+			msg:      "an error getting the stats",
+		},
+	}
+
+	for _, test := range tests {
+		sc := NewTCPServerStreamCollector(test.client, func() map[string]types.NamespacedName { return zones })
+
+		if err := testutil.CollectAndCompare(sc, strings.NewReader(test.expected), test.metricNames...); err != nil {
+			t.Errorf("the TCPServer metrics are not the expected ones for the case of %s: %v", test.msg, err)
+		}
+	}
+}
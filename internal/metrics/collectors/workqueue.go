@@ -0,0 +1,156 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const workqueueSubsystem = "workqueue"
+
+var labelNamesWorkqueue = []string{"name"}
+
+// WorkqueueMetricsProvider implements the workqueue.MetricsProvider interface and prometheus.Collector interface.
+// Set it with workqueue.SetProvider before the workqueues are created.
+type WorkqueueMetricsProvider struct {
+	depth                   *prometheus.GaugeVec
+	adds                    *prometheus.CounterVec
+	latency                 *prometheus.HistogramVec
+	workDuration            *prometheus.HistogramVec
+	unfinishedWork          *prometheus.GaugeVec
+	longestRunningProcessor *prometheus.GaugeVec
+	retries                 *prometheus.CounterVec
+}
+
+// NewWorkqueueMetricsProvider creates a new WorkqueueMetricsProvider
+func NewWorkqueueMetricsProvider() *WorkqueueMetricsProvider {
+	return &WorkqueueMetricsProvider{
+		depth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      "depth",
+				Namespace: metricsNamespace,
+				Subsystem: workqueueSubsystem,
+				Help:      "Current depth of the workqueue",
+			},
+			labelNamesWorkqueue,
+		),
+		adds: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:      "adds_total",
+				Namespace: metricsNamespace,
+				Subsystem: workqueueSubsystem,
+				Help:      "Number of adds handled by the workqueue",
+			},
+			labelNamesWorkqueue,
+		),
+		latency: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:      "queue_duration_seconds",
+				Namespace: metricsNamespace,
+				Subsystem: workqueueSubsystem,
+				Help:      "How long in seconds an item stays in the workqueue before being processed",
+				Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+			},
+			labelNamesWorkqueue,
+		),
+		workDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:      "work_duration_seconds",
+				Namespace: metricsNamespace,
+				Subsystem: workqueueSubsystem,
+				Help:      "How long in seconds processing an item from the workqueue takes",
+				Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+			},
+			labelNamesWorkqueue,
+		),
+		unfinishedWork: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      "unfinished_work_seconds",
+				Namespace: metricsNamespace,
+				Subsystem: workqueueSubsystem,
+				Help: "How many seconds of work has been done that is in progress and hasn't been observed by work_duration. " +
+					"Large values indicate stuck workers",
+			},
+			labelNamesWorkqueue,
+		),
+		longestRunningProcessor: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      "longest_running_processor_seconds",
+				Namespace: metricsNamespace,
+				Subsystem: workqueueSubsystem,
+				Help:      "How many seconds the longest running worker of the workqueue has been running",
+			},
+			labelNamesWorkqueue,
+		),
+		retries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:      "retries_total",
+				Namespace: metricsNamespace,
+				Subsystem: workqueueSubsystem,
+				Help:      "Number of retries handled by the workqueue",
+			},
+			labelNamesWorkqueue,
+		),
+	}
+}
+
+// NewDepthMetric implements workqueue.MetricsProvider interface NewDepthMetric method
+func (wp *WorkqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return wp.depth.WithLabelValues(name)
+}
+
+// NewAddsMetric implements workqueue.MetricsProvider interface NewAddsMetric method
+func (wp *WorkqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return wp.adds.WithLabelValues(name)
+}
+
+// NewLatencyMetric implements workqueue.MetricsProvider interface NewLatencyMetric method
+func (wp *WorkqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return wp.latency.WithLabelValues(name)
+}
+
+// NewWorkDurationMetric implements workqueue.MetricsProvider interface NewWorkDurationMetric method
+func (wp *WorkqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return wp.workDuration.WithLabelValues(name)
+}
+
+// NewUnfinishedWorkSecondsMetric implements workqueue.MetricsProvider interface NewUnfinishedWorkSecondsMetric method
+func (wp *WorkqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return wp.unfinishedWork.WithLabelValues(name)
+}
+
+// NewLongestRunningProcessorSecondsMetric implements workqueue.MetricsProvider interface NewLongestRunningProcessorSecondsMetric method
+func (wp *WorkqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return wp.longestRunningProcessor.WithLabelValues(name)
+}
+
+// NewRetriesMetric implements workqueue.MetricsProvider interface NewRetriesMetric method
+func (wp *WorkqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return wp.retries.WithLabelValues(name)
+}
+
+// Describe implements prometheus.Collector interface Describe method
+func (wp *WorkqueueMetricsProvider) Describe(ch chan<- *prometheus.Desc) {
+	wp.depth.Describe(ch)
+	wp.adds.Describe(ch)
+	wp.latency.Describe(ch)
+	wp.workDuration.Describe(ch)
+	wp.unfinishedWork.Describe(ch)
+	wp.longestRunningProcessor.Describe(ch)
+	wp.retries.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface Collect method
+func (wp *WorkqueueMetricsProvider) Collect(ch chan<- prometheus.Metric) {
+	wp.depth.Collect(ch)
+	wp.adds.Collect(ch)
+	wp.latency.Collect(ch)
+	wp.workDuration.Collect(ch)
+	wp.unfinishedWork.Collect(ch)
+	wp.longestRunningProcessor.Collect(ch)
+	wp.retries.Collect(ch)
+}
+
+// Register registers all the metrics of the collector
+func (wp *WorkqueueMetricsProvider) Register(registry *prometheus.Registry) error {
+	return registry.Register(wp)
+}
@@ -0,0 +1,37 @@
+package collectors
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWorkqueueMetricsProvider(t *testing.T) {
+	wp := NewWorkqueueMetricsProvider()
+
+	// the metrics of the queues are told apart by the name of the queues
+	wp.NewAddsMetric("tcpservers").Inc()
+	wp.NewAddsMetric("tcpservers").Inc()
+	wp.NewAddsMetric("configmaps").Inc()
+	wp.NewDepthMetric("tcpservers").Inc()
+	wp.NewRetriesMetric("tcpservers").Inc()
+
+	expected := `
+# HELP kube_agent_workqueue_adds_total Number of adds handled by the workqueue
+# TYPE kube_agent_workqueue_adds_total counter
+kube_agent_workqueue_adds_total{name="configmaps"} 1
+kube_agent_workqueue_adds_total{name="tcpservers"} 2
+# HELP kube_agent_workqueue_depth Current depth of the workqueue
+# TYPE kube_agent_workqueue_depth gauge
+kube_agent_workqueue_depth{name="tcpservers"} 1
+# HELP kube_agent_workqueue_retries_total Number of retries handled by the workqueue
+# TYPE kube_agent_workqueue_retries_total counter
+kube_agent_workqueue_retries_total{name="tcpservers"} 1
+`
+	err := testutil.CollectAndCompare(wp, strings.NewReader(expected),
+		"kube_agent_workqueue_adds_total", "kube_agent_workqueue_depth", "kube_agent_workqueue_retries_total")
+	if err != nil {
+		t.Errorf("the workqueue metrics are not the expected ones: %v", err)
+	}
+}
@@ -5,12 +5,12 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/golang/glog"
 	plusClient "github.com/nginxinc/nginx-plus-go-client/client"
 	prometheusClient "github.com/nginxinc/nginx-prometheus-exporter/client"
 	nginxCollector "github.com/nginxinc/nginx-prometheus-exporter/collector"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
 )
 
 // metricsEndpoint is the path where prometheus metrics will be exposed
@@ -23,13 +23,13 @@ func NewNginxMetricsClient(httpClient *http.Client) (*prometheusClient.NginxClie
 
 // RunPrometheusListenerForNginx runs an http server to expose Prometheus metrics for NGINX
 func RunPrometheusListenerForNginx(port int, client *prometheusClient.NginxClient, registry *prometheus.Registry) {
-	registry.MustRegister(nginxCollector.NewNginxCollector(client, "nginx_ingress_nginx"))
+	registry.MustRegister(nginxCollector.NewNginxCollector(client, "kube_agent_nginx"))
 	runServer(strconv.Itoa(port), registry)
 }
 
 // RunPrometheusListenerForNginxPlus runs an http server to expose Prometheus metrics for NGINX Plus
 func RunPrometheusListenerForNginxPlus(port int, plusClient *plusClient.NginxClient, registry *prometheus.Registry) {
-	registry.MustRegister(nginxCollector.NewNginxPlusCollector(plusClient, "nginx_ingress_nginxplus"))
+	registry.MustRegister(nginxCollector.NewNginxPlusCollector(plusClient, "kube_agent_nginxplus"))
 	runServer(strconv.Itoa(port), registry)
 }
 
@@ -38,17 +38,17 @@ func runServer(port string, registry prometheus.Gatherer) {
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte(`<html>
-			<head><title>NGINX Ingress Controller</title></head>
+			<head><title>kube-agent</title></head>
 			<body>
-			<h1>NGINX Ingress Controller</h1>
+			<h1>kube-agent</h1>
 			<p><a href='/metrics'>Metrics</a></p>
 			</body>
 			</html>`))
 		if err != nil {
-			glog.Warningf("Error while sending a response for the '/' path: %v", err)
+			klog.ErrorS(err, "Error while sending a response", "path", "/")
 		}
 	})
 	address := fmt.Sprintf(":%v", port)
-	glog.Infof("Starting Prometheus listener on: %v%v", address, metricsEndpoint)
-	glog.Fatal("Error in Prometheus listener server: ", http.ListenAndServe(address, nil))
+	klog.InfoS("Starting Prometheus listener", "address", address, "path", metricsEndpoint)
+	klog.Fatal("Error in Prometheus listener server: ", http.ListenAndServe(address, nil))
 }
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestNewNginxMetricsClient(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "kube-agent-test")
+	if err != nil {
+		t.Fatalf("error creating a temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// a fake NGINX serves stub_status on a unix socket, like the server of the main config
+	socket := path.Join(tempDir, "nginx-status.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("error listening on %v: %v", socket, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stub_status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Active connections: 2 \nserver accepts handled requests\n 10 9 30 \nReading: 0 Writing: 1 Waiting: 1 \n")
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		},
+	}
+
+	client, err := NewNginxMetricsClient(httpClient)
+	if err != nil {
+		t.Fatalf("NewNginxMetricsClient() returned unexpected error: %v", err)
+	}
+
+	stats, err := client.GetStubStats()
+	if err != nil {
+		t.Fatalf("GetStubStats() returned unexpected error: %v", err)
+	}
+	if stats.Connections.Active != 2 || stats.Connections.Accepted != 10 || stats.Requests != 30 {
+		t.Errorf("GetStubStats() returned %+v, expected 2 active connections, 10 accepted connections and 30 requests", stats)
+	}
+}
@@ -0,0 +1,122 @@
+package nginx
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// versionRegexp matches the version line of nginx -V, for example "nginx version: nginx/1.17.3 (nginx-plus-r19)".
+var versionRegexp = regexp.MustCompile(`nginx version: nginx/(\S+)(?: \((nginx-plus[^)]*)\))?`)
+
+// defaultStreamModules are built with the stream module, unless the configure arguments exclude them.
+var defaultStreamModules = []string{
+	"stream_access",
+	"stream_core",
+	"stream_geo",
+	"stream_limit_conn",
+	"stream_log",
+	"stream_map",
+	"stream_proxy",
+	"stream_return",
+	"stream_split_clients",
+	"stream_upstream",
+	"stream_upstream_hash",
+	"stream_upstream_least_conn",
+	"stream_upstream_random",
+	"stream_upstream_zone",
+}
+
+// Capabilities describes an NGINX binary: its version and the modules compiled into it.
+type Capabilities struct {
+	Version string
+	// PlusRelease is the NGINX Plus release, for example nginx-plus-r19. Empty for NGINX OSS.
+	PlusRelease string
+	// Modules are the names of the modules without the _module suffix, for example stream_ssl_preread.
+	// Dynamic modules are included, as the main configuration of the image is expected to load the modules it ships.
+	Modules map[string]bool
+}
+
+// IsPlus checks if the binary is NGINX Plus.
+func (c *Capabilities) IsPlus() bool {
+	return c.PlusRelease != ""
+}
+
+// HasModule checks if the module is built with the binary, statically or as a dynamic module.
+func (c *Capabilities) HasModule(name string) bool {
+	return c.Modules[name]
+}
+
+// GetModules returns the sorted names of the modules.
+func (c *Capabilities) GetModules() []string {
+	var modules []string
+	for module := range c.Modules {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// DetectCapabilities runs nginx -V to detect the capabilities of the NGINX binary.
+func DetectCapabilities(binaryFilename string) (*Capabilities, error) {
+	output, err := exec.Command(binaryFilename, "-V").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%v -V failed: %v: %s", binaryFilename, err, output)
+	}
+
+	return parseCapabilities(string(output))
+}
+
+// parseCapabilities parses the output of nginx -V.
+func parseCapabilities(output string) (*Capabilities, error) {
+	match := versionRegexp.FindStringSubmatch(output)
+	if match == nil {
+		return nil, fmt.Errorf("no version found in the output of nginx -V: %q", output)
+	}
+
+	capabilities := &Capabilities{
+		Version:     match[1],
+		PlusRelease: match[2],
+		Modules:     make(map[string]bool),
+	}
+
+	var arguments []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "configure arguments:") {
+			arguments = strings.Fields(strings.TrimPrefix(line, "configure arguments:"))
+		}
+	}
+
+	excluded := make(map[string]bool)
+	for _, argument := range arguments {
+		if strings.HasPrefix(argument, "--without-") {
+			excluded[strings.TrimSuffix(strings.TrimPrefix(argument, "--without-"), "_module")] = true
+			continue
+		}
+
+		if !strings.HasPrefix(argument, "--with-") {
+			continue
+		}
+
+		// --with-X=dynamic builds a dynamic module, other arguments with values are not modules
+		argument = strings.TrimSuffix(argument, "=dynamic")
+		if strings.Contains(argument, "=") {
+			continue
+		}
+
+		module := strings.TrimSuffix(strings.TrimPrefix(argument, "--with-"), "_module")
+		capabilities.Modules[module] = true
+	}
+
+	if capabilities.Modules["stream"] {
+		for _, module := range defaultStreamModules {
+			if !excluded[module] {
+				capabilities.Modules[module] = true
+			}
+		}
+	}
+
+	return capabilities, nil
+}
@@ -0,0 +1,65 @@
+package nginx
+
+import (
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	output := `nginx version: nginx/1.17.3 (nginx-plus-r19)
+built by gcc 8.3.0 (Debian 8.3.0-6)
+built with OpenSSL 1.1.1d  10 Sep 2019
+TLS SNI support enabled
+configure arguments: --prefix=/etc/nginx --sbin-path=/usr/sbin/nginx --with-cc-opt='-g -O2' --with-http_ssl_module --with-stream --with-stream_ssl_preread_module --with-stream_realip_module --without-stream_geo_module --with-stream_geoip_module=dynamic
+`
+
+	capabilities, err := parseCapabilities(output)
+	if err != nil {
+		t.Fatalf("parseCapabilities() returned unexpected error: %v", err)
+	}
+
+	if capabilities.Version != "1.17.3" || capabilities.PlusRelease != "nginx-plus-r19" || !capabilities.IsPlus() {
+		t.Errorf("parseCapabilities() returned the version %q and the Plus release %q, expected 1.17.3 and nginx-plus-r19", capabilities.Version, capabilities.PlusRelease)
+	}
+
+	for _, module := range []string{"stream", "stream_ssl_preread", "stream_realip", "stream_return", "stream_geoip", "http_ssl"} {
+		if !capabilities.HasModule(module) {
+			t.Errorf("parseCapabilities() didn't detect the module %v", module)
+		}
+	}
+	for _, module := range []string{"stream_geo", "http_v2", "cc-opt"} {
+		if capabilities.HasModule(module) {
+			t.Errorf("parseCapabilities() detected the module %v, which isn't compiled into the binary", module)
+		}
+	}
+}
+
+func TestParseCapabilitiesDynamicStream(t *testing.T) {
+	capabilities, err := parseCapabilities("nginx version: nginx/1.17.4\nconfigure arguments: --with-stream=dynamic --without-stream_map_module\n")
+	if err != nil {
+		t.Fatalf("parseCapabilities() returned unexpected error: %v", err)
+	}
+
+	for _, module := range []string{"stream", "stream_proxy", "stream_upstream"} {
+		if !capabilities.HasModule(module) {
+			t.Errorf("parseCapabilities() didn't detect the module %v of the dynamic stream module", module)
+		}
+	}
+	if capabilities.HasModule("stream_map") {
+		t.Errorf("parseCapabilities() detected the module stream_map, which isn't built with the binary")
+	}
+}
+
+func TestParseCapabilitiesOSS(t *testing.T) {
+	capabilities, err := parseCapabilities("nginx version: nginx/1.17.4\nconfigure arguments: --with-http_ssl_module\n")
+	if err != nil {
+		t.Fatalf("parseCapabilities() returned unexpected error: %v", err)
+	}
+
+	if capabilities.IsPlus() || capabilities.HasModule("stream") || capabilities.HasModule("stream_return") {
+		t.Errorf("parseCapabilities() returned %+v for NGINX without the stream module", capabilities)
+	}
+
+	if _, err := parseCapabilities("sh: nginx: not found"); err == nil {
+		t.Errorf("parseCapabilities() returned no error for an output without a version")
+	}
+}
@@ -1,12 +1,13 @@
 package nginx
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"path"
 
-	"github.com/golang/glog"
 	"github.com/nginxinc/nginx-plus-go-client/client"
+	"k8s.io/klog/v2"
 )
 
 // FakeManager provides a fake implementation of the Manager interface.
@@ -26,31 +27,71 @@ func NewFakeManager(confPath string) *FakeManager {
 }
 
 // CreateMainConfig provides a fake implementation of CreateMainConfig.
-func (*FakeManager) CreateMainConfig(content []byte) {
-	glog.V(3).Info("Writing main config")
-	glog.V(3).Info(string(content))
+func (*FakeManager) CreateMainConfig(content []byte) error {
+	klog.V(3).InfoS("Writing main config", "content", string(content))
+	return nil
+}
+
+// ApplyMainConfig provides a fake implementation of ApplyMainConfig.
+func (fm *FakeManager) ApplyMainConfig(ctx context.Context, content []byte, changes []ConfigChange) error {
+	klog.V(3).InfoS("Writing main config", "content", string(content))
+	return fm.ApplyConfigs(ctx, changes)
 }
 
 // CreateConfig provides a fake implementation of CreateConfig.
-func (*FakeManager) CreateConfig(name string, content []byte) {
-	glog.V(3).Infof("Writing config %v", name)
-	glog.V(3).Info(string(content))
+func (*FakeManager) CreateConfig(name string, content []byte) error {
+	klog.V(3).InfoS("Writing config", "name", name, "content", string(content))
+	return nil
 }
 
 // DeleteConfig provides a fake implementation of DeleteConfig.
-func (*FakeManager) DeleteConfig(name string) {
-	glog.V(3).Infof("Deleting config %v", name)
+func (*FakeManager) DeleteConfig(name string) error {
+	klog.V(3).InfoS("Deleting config", "name", name)
+	return nil
+}
+
+// ReadConfig provides a fake implementation of ReadConfig.
+func (*FakeManager) ReadConfig(name string) ([]byte, error) {
+	klog.V(3).InfoS("Reading config", "name", name)
+	return nil, nil
+}
+
+// ApplyConfigs provides a fake implementation of ApplyConfigs.
+func (*FakeManager) ApplyConfigs(ctx context.Context, changes []ConfigChange) error {
+	for _, change := range changes {
+		if change.Content == nil {
+			klog.V(3).InfoS("Deleting config", "name", change.Name)
+			continue
+		}
+		klog.V(3).InfoS("Writing config", "name", change.Name, "content", string(change.Content))
+	}
+	klog.V(3).InfoS("Testing and reloading nginx")
+	return nil
+}
+
+// WriteConfigsWithoutReload provides a fake implementation of WriteConfigsWithoutReload.
+func (*FakeManager) WriteConfigsWithoutReload(changes []ConfigChange) error {
+	for _, change := range changes {
+		if change.Content == nil {
+			klog.V(3).InfoS("Deleting config", "name", change.Name)
+			continue
+		}
+		klog.V(3).InfoS("Writing config", "name", change.Name, "content", string(change.Content))
+	}
+	klog.V(3).InfoS("Testing nginx config")
+	return nil
 }
 
 // CreateSecret provides a fake implementation of CreateSecret.
-func (fm *FakeManager) CreateSecret(name string, content []byte, mode os.FileMode) string {
-	glog.V(3).Infof("Writing secret %v", name)
-	return fm.GetFilenameForSecret(name)
+func (fm *FakeManager) CreateSecret(name string, content []byte, mode os.FileMode) (string, error) {
+	klog.V(3).InfoS("Writing secret", "name", name)
+	return fm.GetFilenameForSecret(name), nil
 }
 
 // DeleteSecret provides a fake implementation of DeleteSecret.
-func (*FakeManager) DeleteSecret(name string) {
-	glog.V(3).Infof("Deleting secret %v", name)
+func (*FakeManager) DeleteSecret(name string) error {
+	klog.V(3).InfoS("Deleting secret", "name", name)
+	return nil
 }
 
 // GetFilenameForSecret provides a fake implementation of GetFilenameForSecret.
@@ -60,29 +101,40 @@ func (fm *FakeManager) GetFilenameForSecret(name string) string {
 
 // CreateDHParam provides a fake implementation of CreateDHParam.
 func (fm *FakeManager) CreateDHParam(content string) (string, error) {
-	glog.V(3).Infof("Writing dhparam file")
+	klog.V(3).InfoS("Writing dhparam file")
 	return fm.dhparamFilename, nil
 }
 
 // Start provides a fake implementation of Start.
 func (*FakeManager) Start(done chan error) {
-	glog.V(3).Info("Starting nginx")
+	klog.V(3).InfoS("Starting nginx")
 }
 
 // Reload provides a fake implementation of Reload.
-func (*FakeManager) Reload() error {
-	glog.V(3).Infof("Reloading nginx")
+func (*FakeManager) Reload(ctx context.Context) error {
+	klog.V(3).InfoS("Reloading nginx")
 	return nil
 }
 
 // Quit provides a fake implementation of Quit.
 func (*FakeManager) Quit() {
-	glog.V(3).Info("Quitting nginx")
+	klog.V(3).InfoS("Quitting nginx")
+}
+
+// CheckHealth provides a fake implementation of CheckHealth.
+func (*FakeManager) CheckHealth() error {
+	return nil
+}
+
+// GetConfigVersions provides a fake implementation of GetConfigVersions.
+func (*FakeManager) GetConfigVersions() (written int, running int, err error) {
+	return 0, 0, nil
 }
 
 // UpdateConfigVersionFile provides a fake implementation of UpdateConfigVersionFile.
-func (*FakeManager) UpdateConfigVersionFile(openTracing bool) {
-	glog.V(3).Infof("Writing config version")
+func (*FakeManager) UpdateConfigVersionFile(openTracing bool) error {
+	klog.V(3).InfoS("Writing config version")
+	return nil
 }
 
 // SetPlusClients provides a fake implementation of SetPlusClients.
@@ -91,13 +143,13 @@ func (*FakeManager) SetPlusClients(plusClient *client.NginxClient, plusConfigVer
 
 // UpdateServersInPlus provides a fake implementation of UpdateServersInPlus.
 func (*FakeManager) UpdateServersInPlus(upstream string, servers []string, config ServerConfig) error {
-	glog.V(3).Infof("Updating servers of %v: %v", upstream, servers)
+	klog.V(3).InfoS("Updating servers", "upstream", upstream, "servers", servers)
 	return nil
 }
 
 // CreateOpenTracingTracerConfig creates a fake implementation of CreateOpenTracingTracerConfig.
 func (*FakeManager) CreateOpenTracingTracerConfig(content string) error {
-	glog.V(3).Infof("Writing OpenTracing tracer config file")
+	klog.V(3).InfoS("Writing OpenTracing tracer config file")
 
 	return nil
 }
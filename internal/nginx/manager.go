@@ -1,17 +1,26 @@
 package nginx
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/mohamed-gougam/kube-agent/internal/metrics/collectors"
+	"github.com/mohamed-gougam/kube-agent/internal/tracing"
 
-	"github.com/golang/glog"
 	"github.com/nginxinc/nginx-plus-go-client/client"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
 )
 
 // TLSSecretFileMode defines the default filemode for files with TLS Secrets.
@@ -23,6 +32,19 @@ const JWKSecretFileMode = 0644
 const configFileMode = 0644
 const jsonFileForOpenTracingTracer = "/var/lib/nginx/tracer-config.json"
 
+// shadowConfPath is where the configuration is staged and tested before it goes live.
+const shadowConfPath = "/var/lib/nginx/shadow"
+
+// lastGoodConfPath is where a copy of the last configuration that NGINX reloaded successfully is kept.
+const lastGoodConfPath = "/var/lib/nginx/last-good"
+
+// configVersionCheckTimeout is how long the health check and GetConfigVersions wait for NGINX to answer
+// on the config version socket.
+const configVersionCheckTimeout = 2 * time.Second
+
+// configTestErrorRegexp matches the file an error reported by nginx -t was found in.
+var configTestErrorRegexp = regexp.MustCompile(`in (\S+\.conf):\d+`)
+
 // ServerConfig holds the config data for an upstream server in NGINX Plus.
 type ServerConfig struct {
 	MaxFails    int
@@ -31,21 +53,66 @@ type ServerConfig struct {
 	SlowStart   string
 }
 
+// ConfigChange describes a change of a configuration file in the conf.d folder.
+// A nil Content deletes the configuration file.
+type ConfigChange struct {
+	Name    string
+	Content []byte
+}
+
+// ConfigTestError is returned when the NGINX configuration test (nginx -t) fails.
+type ConfigTestError struct {
+	// Names of the configuration files the errors were found in. Empty if the errors couldn't be attributed to a file
+	// in the conf.d folder.
+	Names  []string
+	Output string
+}
+
+func (e *ConfigTestError) Error() string {
+	return fmt.Sprintf("nginx configuration test failed: %v", e.Output)
+}
+
+// RollbackError is returned when NGINX failed to reload with a new configuration and was successfully
+// rolled back to the last configuration that it reloaded with.
+type RollbackError struct {
+	Err error
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("%v; rolled back to the last good configuration", e.Err)
+}
+
+// WriteError is returned when the configuration files couldn't be written. The configuration files are restored
+// to the last good configuration and NGINX is not reloaded, so the changes can be applied again later.
+type WriteError struct {
+	Err error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("failed to write the nginx configuration: %v", e.Err)
+}
+
 // The Manager interface updates NGINX configuration, starts, reloads and quits NGINX,
 // updates NGINX Plus upstream servers.
 type Manager interface {
-	CreateMainConfig(content []byte)
-	CreateConfig(name string, content []byte)
-	DeleteConfig(name string)
-	CreateSecret(name string, content []byte, mode os.FileMode) string
-	DeleteSecret(name string)
+	CreateMainConfig(content []byte) error
+	ApplyMainConfig(ctx context.Context, content []byte, changes []ConfigChange) error
+	CreateConfig(name string, content []byte) error
+	DeleteConfig(name string) error
+	ReadConfig(name string) ([]byte, error)
+	ApplyConfigs(ctx context.Context, changes []ConfigChange) error
+	WriteConfigsWithoutReload(changes []ConfigChange) error
+	CreateSecret(name string, content []byte, mode os.FileMode) (string, error)
+	DeleteSecret(name string) error
 	GetFilenameForSecret(name string) string
 	CreateDHParam(content string) (string, error)
 	CreateOpenTracingTracerConfig(content string) error
 	Start(done chan error)
-	Reload() error
+	Reload(ctx context.Context) error
 	Quit()
-	UpdateConfigVersionFile(openTracing bool)
+	CheckHealth() error
+	GetConfigVersions() (written int, running int, err error)
+	UpdateConfigVersionFile(openTracing bool) error
 	SetPlusClients(plusClient *client.NginxClient, plusConfigVersionCheckClient *http.Client)
 	UpdateServersInPlus(upstream string, servers []string, config ServerConfig) error
 	SetOpenTracing(openTracing bool)
@@ -53,8 +120,19 @@ type Manager interface {
 
 // LocalManager updates NGINX configuration, starts, reloads and quits NGINX,
 // updates NGINX Plus upstream servers. It assumes that NGINX is running in the same container.
+// Config file writes, config version bumps and reloads are serialized, so LocalManager is safe for concurrent use.
+// Files are written to a temp file first and then renamed, so NGINX never reads a partially written file.
+// NGINX is supervised: if it exits unexpectedly, it is restarted.
 type LocalManager struct {
+	lock sync.Mutex
+	// stateLock protects master, configVersion and restarting for the readers that don't hold lock, like the health
+	// check, which must not wait for a reload or a restart of NGINX. The writers of master and configVersion hold both
+	// locks. restarting is true while the supervisor waits for the backoff and restarts NGINX.
+	stateLock                    sync.Mutex
 	confdPath                    string
+	shadowConfPath               string
+	lastGoodConfPath             string
+	hasLastGoodConf              bool
 	secretsPath                  string
 	mainConfFilename             string
 	configVersionFilename        string
@@ -63,23 +141,33 @@ type LocalManager struct {
 	verifyConfigGenerator        *verifyConfigGenerator
 	verifyClient                 *verifyClient
 	configVersion                int
-	reloadCmd                    string
-	quitCmd                      string
+	pidFilename                  string
+	master                       *nginxMaster
+	restarting                   bool
 	plusClient                   *client.NginxClient
 	plusConfigVersionCheckClient *http.Client
 	metricsCollector             collectors.ManagerCollector
 	OpenTracing                  bool
+	maxRestarts                  int
+	minRestartBackoff            time.Duration
+	maxRestartBackoff            time.Duration
+	stableRunDuration            time.Duration
+	quitCh                       chan struct{}
+	quitOnce                     sync.Once
 }
 
-// NewLocalManager creates a LocalManager.
-func NewLocalManager(confPath string, binaryFilename string, mc collectors.ManagerCollector) *LocalManager {
+// NewLocalManager creates a LocalManager. NGINX is restarted up to maxRestarts times in a row
+// after it exits unexpectedly.
+func NewLocalManager(confPath string, binaryFilename string, mc collectors.ManagerCollector, maxRestarts int) *LocalManager {
 	verifyConfigGenerator, err := newVerifyConfigGenerator()
 	if err != nil {
-		glog.Fatalf("error instantiating a verifyConfigGenerator: %v", err)
+		klog.Fatalf("error instantiating a verifyConfigGenerator: %v", err)
 	}
 
 	manager := LocalManager{
 		confdPath:        path.Join(confPath, "conf.d"),
+		shadowConfPath:   shadowConfPath,
+		lastGoodConfPath: lastGoodConfPath,
 		secretsPath:      path.Join(confPath, "secrets"),
 		dhparamFilename:  path.Join(confPath, "secrets", "dhparam.pem"),
 		mainConfFilename: path.Join(confPath, "nginx.conf"),
@@ -89,74 +177,285 @@ func NewLocalManager(confPath string, binaryFilename string, mc collectors.Manag
 		verifyConfigGenerator: verifyConfigGenerator,
 		configVersion:         0,
 		verifyClient:          newVerifyClient(),
-		reloadCmd:             fmt.Sprintf("%v -s %v", binaryFilename, "reload"),
-		quitCmd:               fmt.Sprintf("%v -s %v", binaryFilename, "quit"),
+		pidFilename:           pidFilename,
 		metricsCollector:      mc,
+		maxRestarts:           maxRestarts,
+		minRestartBackoff:     defaultMinRestartBackoff,
+		maxRestartBackoff:     defaultMaxRestartBackoff,
+		stableRunDuration:     defaultStableRunDuration,
+		quitCh:                make(chan struct{}),
 	}
 
 	return &manager
 }
 
 // CreateMainConfig creates the main NGINX configuration file. If the file already exists, it will be overridden.
-func (lm *LocalManager) CreateMainConfig(content []byte) {
-	glog.V(3).Infof("Writing main config to %v", lm.mainConfFilename)
-	glog.V(3).Infof(string(content))
+func (lm *LocalManager) CreateMainConfig(content []byte) error {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
 
-	err := createFileAndWrite(lm.mainConfFilename, content)
-	if err != nil {
-		glog.Fatalf("Failed to write main config: %v", err)
+	klog.V(3).InfoS("Writing main config", "filename", lm.mainConfFilename, "content", string(content))
+
+	if err := createFileAndWrite(lm.mainConfFilename, content); err != nil {
+		return fmt.Errorf("Failed to write main config: %v", err)
 	}
+
+	return nil
 }
 
 // CreateConfig creates a configuration file. If the file already exists, it will be overridden.
-func (lm *LocalManager) CreateConfig(name string, content []byte) {
+func (lm *LocalManager) CreateConfig(name string, content []byte) error {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	return lm.createConfig(name, content)
+}
+
+func (lm *LocalManager) createConfig(name string, content []byte) error {
 	filename := lm.getFilenameForConfig(name)
 
-	glog.V(3).Infof("Writing config to %v", filename)
-	glog.V(3).Info(string(content))
+	klog.V(3).InfoS("Writing config", "filename", filename, "content", string(content))
 
-	err := createFileAndWrite(filename, content)
-	if err != nil {
-		glog.Fatalf("Failed to write config to %v: %v", filename, err)
+	if err := createFileAndWrite(filename, content); err != nil {
+		return fmt.Errorf("Failed to write config to %v: %v", filename, err)
 	}
+
+	return nil
 }
 
-// DeleteConfig deletes the configuration file from the conf.d folder.
-func (lm *LocalManager) DeleteConfig(name string) {
+// DeleteConfig deletes the configuration file from the conf.d folder. Deleting a file that doesn't exist succeeds.
+func (lm *LocalManager) DeleteConfig(name string) error {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	return lm.deleteConfig(name)
+}
+
+func (lm *LocalManager) deleteConfig(name string) error {
 	filename := lm.getFilenameForConfig(name)
 
-	glog.V(3).Infof("Deleting config from %v", filename)
+	klog.V(3).InfoS("Deleting config", "filename", filename)
 
-	if err := os.Remove(filename); err != nil {
-		glog.Warningf("Failed to delete config from %v: %v", filename, err)
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to delete config from %v: %v", filename, err)
 	}
+
+	return nil
+}
+
+// ApplyConfigs creates, overrides or deletes the configuration files and reloads NGINX once.
+// No other config file write or reload can happen until NGINX runs with the new configuration.
+// The changes are first tested with nginx -t in a copy of the configuration. If the test fails, nothing is changed
+// and a *ConfigTestError is returned.
+func (lm *LocalManager) ApplyConfigs(ctx context.Context, changes []ConfigChange) error {
+	ctx, span := tracing.Tracer().Start(ctx, "LocalManager.ApplyConfigs", trace.WithAttributes(tracing.ConfigChangesKey.Int(len(changes))))
+	defer span.End()
+
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	err := lm.applyConfigs(ctx, nil, changes)
+	tracing.SetError(span, err)
+
+	return err
+}
+
+// applyConfigs tests the configuration with the changes, writes it and reloads NGINX.
+func (lm *LocalManager) applyConfigs(ctx context.Context, mainContent []byte, changes []ConfigChange) error {
+	_, testSpan := tracing.Tracer().Start(ctx, "LocalManager.testConfigs")
+	err := lm.testConfigs(mainContent, changes)
+	tracing.SetError(testSpan, err)
+	testSpan.End()
+	if err != nil {
+		return err
+	}
+
+	_, writeSpan := tracing.Tracer().Start(ctx, "LocalManager.writeConfigs")
+	err = lm.writeConfigs(mainContent, changes)
+	tracing.SetError(writeSpan, err)
+	writeSpan.End()
+	if err != nil {
+		return err
+	}
+
+	return lm.reload(ctx)
+}
+
+// WriteConfigsWithoutReload creates, overrides or deletes the configuration files without reloading NGINX, for changes
+// NGINX already runs, like the upstream servers updated through the NGINX Plus API. The changes are tested with nginx -t
+// first, and the written configuration becomes the last good configuration, so that a rollback doesn't restore the
+// configuration from before the changes.
+func (lm *LocalManager) WriteConfigsWithoutReload(changes []ConfigChange) error {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	if err := lm.testConfigs(nil, changes); err != nil {
+		return err
+	}
+
+	if err := lm.writeConfigs(nil, changes); err != nil {
+		return err
+	}
+
+	lm.saveLastGoodConf()
+
+	return nil
+}
+
+// writeConfigs writes the main configuration file, if mainContent is not nil, and applies the changes to the configuration
+// files. If a write fails, the last good configuration is restored and a *WriteError is returned.
+func (lm *LocalManager) writeConfigs(mainContent []byte, changes []ConfigChange) error {
+	err := lm.writeConfigFiles(mainContent, changes)
+	if err == nil {
+		return nil
+	}
+
+	if lm.hasLastGoodConf {
+		if restoreErr := lm.restoreLastGoodConf(); restoreErr != nil {
+			klog.ErrorS(restoreErr, "Failed to restore the last good config after a failed write")
+		}
+	}
+
+	return &WriteError{Err: err}
+}
+
+func (lm *LocalManager) writeConfigFiles(mainContent []byte, changes []ConfigChange) error {
+	if mainContent != nil {
+		if err := createFileAndWrite(lm.mainConfFilename, mainContent); err != nil {
+			return fmt.Errorf("Failed to write main config: %v", err)
+		}
+	}
+
+	for _, change := range changes {
+		if change.Content == nil {
+			if err := lm.deleteConfig(change.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := lm.createConfig(change.Name, change.Content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadConfig reads the configuration file with the name, as last written for NGINX. The files are renamed into
+// place, so it doesn't wait for a write in progress.
+func (lm *LocalManager) ReadConfig(name string) ([]byte, error) {
+	return ioutil.ReadFile(lm.getFilenameForConfig(name))
 }
 
 func (lm *LocalManager) getFilenameForConfig(name string) string {
 	return path.Join(lm.confdPath, name+".conf")
 }
 
+// ApplyMainConfig overrides the main NGINX configuration file, creates, overrides or deletes the configuration files
+// and reloads NGINX once. The new configuration is first tested with nginx -t. If the test fails, nothing is changed
+// and a *ConfigTestError is returned.
+func (lm *LocalManager) ApplyMainConfig(ctx context.Context, content []byte, changes []ConfigChange) error {
+	ctx, span := tracing.Tracer().Start(ctx, "LocalManager.ApplyMainConfig", trace.WithAttributes(tracing.ConfigChangesKey.Int(len(changes))))
+	defer span.End()
+
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	err := lm.applyConfigs(ctx, content, changes)
+	tracing.SetError(span, err)
+
+	return err
+}
+
+// testConfigs copies the configuration to the shadow folder, applies the changes there and runs nginx -t against it.
+// If mainContent is not nil, it replaces the main configuration file of the copy.
+func (lm *LocalManager) testConfigs(mainContent []byte, changes []ConfigChange) error {
+	if err := os.RemoveAll(lm.shadowConfPath); err != nil {
+		return fmt.Errorf("Failed to clean up the shadow config %v: %v", lm.shadowConfPath, err)
+	}
+
+	if err := copyDir(path.Dir(lm.mainConfFilename), lm.shadowConfPath); err != nil {
+		return fmt.Errorf("Failed to copy the config to %v: %v", lm.shadowConfPath, err)
+	}
+
+	shadowConfdPath := path.Join(lm.shadowConfPath, path.Base(lm.confdPath))
+
+	for _, change := range changes {
+		filename := path.Join(shadowConfdPath, change.Name+".conf")
+
+		if change.Content == nil {
+			if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("Failed to delete shadow config %v: %v", filename, err)
+			}
+			continue
+		}
+
+		if err := createFileAndWrite(filename, change.Content); err != nil {
+			return fmt.Errorf("Failed to write shadow config: %v", err)
+		}
+	}
+
+	shadowMainConfFilename := path.Join(lm.shadowConfPath, path.Base(lm.mainConfFilename))
+
+	if mainContent != nil {
+		if err := createFileAndWrite(shadowMainConfFilename, mainContent); err != nil {
+			return fmt.Errorf("Failed to write shadow main config: %v", err)
+		}
+	}
+
+	klog.V(3).InfoS("Testing config", "filename", shadowMainConfFilename)
+
+	output, err := exec.Command(lm.binaryFilename, "-t", "-q", "-c", shadowMainConfFilename).CombinedOutput()
+	if err != nil {
+		return &ConfigTestError{
+			Names:  getConfigNamesFromTestOutput(string(output), shadowConfdPath),
+			Output: strings.TrimSpace(string(output)),
+		}
+	}
+
+	return nil
+}
+
+// getConfigNamesFromTestOutput returns the names of the configs of the confdPath folder that nginx -t reported errors in.
+func getConfigNamesFromTestOutput(output string, confdPath string) []string {
+	var names []string
+
+	for _, match := range configTestErrorRegexp.FindAllStringSubmatch(output, -1) {
+		relPath, err := filepath.Rel(confdPath, match[1])
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(relPath, ".conf"))
+	}
+
+	return names
+}
+
 // CreateSecret creates a secret file with the specified name, content and mode. If the file already exists,
 // it will be overridden.
-func (lm *LocalManager) CreateSecret(name string, content []byte, mode os.FileMode) string {
+func (lm *LocalManager) CreateSecret(name string, content []byte, mode os.FileMode) (string, error) {
 	filename := lm.GetFilenameForSecret(name)
 
-	glog.V(3).Infof("Writing secret to %v", filename)
+	klog.V(3).InfoS("Writing secret", "filename", filename)
 
-	createFileAndWriteAtomically(filename, lm.secretsPath, mode, content)
+	if err := createFileAndWriteAtomically(filename, lm.secretsPath, mode, content); err != nil {
+		return filename, fmt.Errorf("Failed to write secret to %v: %v", filename, err)
+	}
 
-	return filename
+	return filename, nil
 }
 
-// DeleteSecret the file with the secret.
-func (lm *LocalManager) DeleteSecret(name string) {
+// DeleteSecret the file with the secret. Deleting a secret that doesn't exist succeeds.
+func (lm *LocalManager) DeleteSecret(name string) error {
 	filename := lm.GetFilenameForSecret(name)
 
-	glog.V(3).Infof("Deleting secret from %v", filename)
+	klog.V(3).InfoS("Deleting secret", "filename", filename)
 
-	if err := os.Remove(filename); err != nil {
-		glog.Warningf("Failed to delete secret from %v: %v", filename, err)
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to delete secret from %v: %v", filename, err)
 	}
+
+	return nil
 }
 
 // GetFilenameForSecret constructs the filename for the secret.
@@ -166,7 +465,7 @@ func (lm *LocalManager) GetFilenameForSecret(name string) string {
 
 // CreateDHParam creates the servers dhparam.pem file. If the file already exists, it will be overridden.
 func (lm *LocalManager) CreateDHParam(content string) (string, error) {
-	glog.V(3).Infof("Writing dhparam file to %v", lm.dhparamFilename)
+	klog.V(3).InfoS("Writing dhparam file", "filename", lm.dhparamFilename)
 
 	err := createFileAndWrite(lm.dhparamFilename, []byte(content))
 	if err != nil {
@@ -176,42 +475,132 @@ func (lm *LocalManager) CreateDHParam(content string) (string, error) {
 	return lm.dhparamFilename, nil
 }
 
-// Start starts NGINX.
+// Start starts NGINX and supervises it. If NGINX exits without Quit being called, it is restarted with the current
+// configuration after a backoff. done receives the exit error of NGINX once it is not restarted anymore:
+// after Quit, or after NGINX exited maxRestarts times in a row.
 func (lm *LocalManager) Start(done chan error) {
-	glog.V(3).Info("Starting nginx")
+	klog.V(3).InfoS("Starting nginx")
+
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	exited, err := lm.startNginx()
+	go lm.supervise(exited, done)
 
-	cmd := exec.Command(lm.binaryFilename)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Start(); err != nil {
-		glog.Fatalf("Failed to start nginx: %v", err)
+	// a configuration NGINX doesn't run is not a rollback target
+	if err == nil {
+		lm.saveLastGoodConf()
 	}
+}
 
-	go func() {
-		done <- cmd.Wait()
-	}()
+// Reload reloads NGINX.
+func (lm *LocalManager) Reload(ctx context.Context) error {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
 
-	err := lm.verifyClient.WaitForCorrectVersion(lm.configVersion)
+	return lm.reload(ctx)
+}
+
+// CheckHealth checks that the NGINX master process is alive and that NGINX answers on the config version socket.
+// It doesn't wait for a reload or a restart of NGINX in progress. NGINX is reported healthy while the supervisor
+// restarts it, so that the liveness probe doesn't fail during the restart backoff. Once NGINX exited maxRestarts times
+// in a row, the supervisor gives up and the health check fails.
+func (lm *LocalManager) CheckHealth() error {
+	lm.stateLock.Lock()
+	master := lm.master
+	restarting := lm.restarting
+	lm.stateLock.Unlock()
+
+	if restarting {
+		return nil
+	}
+
+	if err := signalMaster(master, lm.pidFilename, 0); err != nil {
+		return err
+	}
+
+	if _, err := lm.verifyClient.GetConfigVersionWithTimeout(configVersionCheckTimeout); err != nil {
+		return fmt.Errorf("nginx doesn't answer on the config version socket: %v", err)
+	}
+
+	return nil
+}
+
+// GetConfigVersions returns the config version of the configuration last written by the LocalManager and the config
+// version NGINX runs. They differ while a reload is in progress, or if NGINX failed to reload.
+func (lm *LocalManager) GetConfigVersions() (written int, running int, err error) {
+	lm.stateLock.Lock()
+	written = lm.configVersion
+	lm.stateLock.Unlock()
+
+	running, err = lm.verifyClient.GetConfigVersionWithTimeout(configVersionCheckTimeout)
 	if err != nil {
-		glog.Fatalf("Could not get newest config version: %v", err)
+		return written, 0, fmt.Errorf("nginx doesn't answer on the config version socket: %v", err)
 	}
+
+	return written, running, nil
 }
 
-// Reload reloads NGINX.
-func (lm *LocalManager) Reload() error {
+// reload reloads NGINX. If NGINX fails to reload, the last good configuration is restored and reloaded.
+func (lm *LocalManager) reload(ctx context.Context) error {
+	ctx, span := tracing.Tracer().Start(ctx, "LocalManager.Reload")
+	defer span.End()
+
+	err := lm.reloadWithNewConfigVersion(ctx)
+	if err == nil {
+		lm.saveLastGoodConf()
+		return nil
+	}
+
+	tracing.SetError(span, err)
+
+	if !lm.hasLastGoodConf {
+		return err
+	}
+
+	klog.ErrorS(err, "Rolling back to the last good configuration", "configVersion", lm.configVersion)
+
+	ctx, rollbackSpan := tracing.Tracer().Start(ctx, "LocalManager.rollback")
+	defer rollbackSpan.End()
+
+	if rollbackErr := lm.rollback(ctx); rollbackErr != nil {
+		tracing.SetError(rollbackSpan, rollbackErr)
+		return fmt.Errorf("%v; rollback to the last good configuration failed: %v", err, rollbackErr)
+	}
+
+	lm.metricsCollector.IncNginxRollbacks()
+
+	return &RollbackError{Err: err}
+}
+
+// reloadWithNewConfigVersion reloads NGINX and waits for it to run the configuration with a new config version.
+func (lm *LocalManager) reloadWithNewConfigVersion(ctx context.Context) error {
+	span := trace.SpanFromContext(ctx)
+
 	// write a new config version
+	lm.stateLock.Lock()
 	lm.configVersion++
-	lm.UpdateConfigVersionFile(lm.OpenTracing)
+	lm.stateLock.Unlock()
+	span.SetAttributes(tracing.ConfigVersionKey.Int(lm.configVersion))
+	if err := lm.updateConfigVersionFile(lm.OpenTracing); err != nil {
+		lm.metricsCollector.IncNginxReloadErrors()
+		return err
+	}
 
-	glog.V(3).Infof("Reloading nginx with configVersion: %v", lm.configVersion)
+	klog.V(3).InfoS("Reloading nginx", "configVersion", lm.configVersion)
 
 	t1 := time.Now()
 
-	if err := shellOut(lm.reloadCmd); err != nil {
+	if err := lm.signalNginx(syscall.SIGHUP); err != nil {
 		lm.metricsCollector.IncNginxReloadErrors()
-		return fmt.Errorf("nginx reload failed: %v", err)
+		return err
 	}
+
+	_, waitSpan := tracing.Tracer().Start(ctx, "LocalManager.waitForConfigVersion",
+		trace.WithAttributes(tracing.ConfigVersionKey.Int(lm.configVersion)))
 	err := lm.verifyClient.WaitForCorrectVersion(lm.configVersion)
+	tracing.SetError(waitSpan, err)
+	waitSpan.End()
 	if err != nil {
 		lm.metricsCollector.IncNginxReloadErrors()
 		return fmt.Errorf("could not get newest config version: %v", err)
@@ -219,31 +608,107 @@ func (lm *LocalManager) Reload() error {
 
 	lm.metricsCollector.IncNginxReloadCount()
 
-	t2 := time.Now()
-	lm.metricsCollector.UpdateLastReloadTime(t2.Sub(t1))
+	reloadDuration := time.Since(t1)
+	lm.metricsCollector.UpdateLastReloadTime(reloadDuration)
+	klog.V(2).InfoS("Reloaded nginx", "configVersion", lm.configVersion, "reloadDuration", reloadDuration)
 	return nil
 }
 
-// Quit shutdowns NGINX gracefully.
+// saveLastGoodConf saves a copy of the current configuration, which NGINX is known to run.
+func (lm *LocalManager) saveLastGoodConf() {
+	lm.hasLastGoodConf = false
+
+	if err := os.RemoveAll(lm.lastGoodConfPath); err != nil {
+		klog.ErrorS(err, "Failed to clean up the last good config", "path", lm.lastGoodConfPath)
+		return
+	}
+
+	if err := copyDir(lm.confdPath, path.Join(lm.lastGoodConfPath, path.Base(lm.confdPath))); err != nil {
+		klog.ErrorS(err, "Failed to save the last good config", "path", lm.lastGoodConfPath)
+		return
+	}
+
+	lastGoodMainConfFilename := path.Join(lm.lastGoodConfPath, path.Base(lm.mainConfFilename))
+	if err := copyFile(lm.mainConfFilename, lastGoodMainConfFilename); err != nil {
+		klog.ErrorS(err, "Failed to save the last good main config", "filename", lastGoodMainConfFilename)
+		return
+	}
+
+	lm.hasLastGoodConf = true
+}
+
+// rollback restores the last good configuration and reloads NGINX with it.
+func (lm *LocalManager) rollback(ctx context.Context) error {
+	if err := lm.restoreLastGoodConf(); err != nil {
+		return err
+	}
+
+	return lm.reloadWithNewConfigVersion(ctx)
+}
+
+// restoreLastGoodConf replaces the configuration files with the last good configuration.
+func (lm *LocalManager) restoreLastGoodConf() error {
+	children, err := ioutil.ReadDir(lm.confdPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read %v: %v", lm.confdPath, err)
+	}
+
+	for _, child := range children {
+		if err := os.RemoveAll(path.Join(lm.confdPath, child.Name())); err != nil {
+			return fmt.Errorf("Failed to delete %v: %v", child.Name(), err)
+		}
+	}
+
+	if err := copyDir(path.Join(lm.lastGoodConfPath, path.Base(lm.confdPath)), lm.confdPath); err != nil {
+		return fmt.Errorf("Failed to restore the last good config: %v", err)
+	}
+
+	lastGoodMainConfFilename := path.Join(lm.lastGoodConfPath, path.Base(lm.mainConfFilename))
+	if err := copyFile(lastGoodMainConfFilename, lm.mainConfFilename); err != nil {
+		return fmt.Errorf("Failed to restore the last good main config: %v", err)
+	}
+
+	return nil
+}
+
+// Quit shutdowns NGINX gracefully. NGINX is not restarted after Quit.
 func (lm *LocalManager) Quit() {
-	glog.V(3).Info("Quitting nginx")
+	klog.V(3).InfoS("Quitting nginx")
 
-	if err := shellOut(lm.quitCmd); err != nil {
-		glog.Fatalf("Failed to quit nginx: %v", err)
+	lm.quitOnce.Do(func() {
+		close(lm.quitCh)
+	})
+
+	// waits for a restart in progress, so that the restarted NGINX is quit too
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	if err := lm.signalNginx(syscall.SIGQUIT); err != nil {
+		klog.ErrorS(err, "Failed to quit nginx")
 	}
 }
 
 // UpdateConfigVersionFile writes the config version file.
-func (lm *LocalManager) UpdateConfigVersionFile(openTracing bool) {
+func (lm *LocalManager) UpdateConfigVersionFile(openTracing bool) error {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	return lm.updateConfigVersionFile(openTracing)
+}
+
+func (lm *LocalManager) updateConfigVersionFile(openTracing bool) error {
 	cfg, err := lm.verifyConfigGenerator.GenerateVersionConfig(lm.configVersion, openTracing)
 	if err != nil {
-		glog.Fatalf("Error generating config version content: %v", err)
+		return fmt.Errorf("Error generating config version content: %v", err)
 	}
 
-	glog.V(3).Infof("Writing config version to %v", lm.configVersionFilename)
-	glog.V(3).Info(string(cfg))
+	klog.V(3).InfoS("Writing config version", "filename", lm.configVersionFilename, "configVersion", lm.configVersion)
 
-	createFileAndWriteAtomically(lm.configVersionFilename, path.Dir(lm.configVersionFilename), configFileMode, cfg)
+	if err := createFileAndWrite(lm.configVersionFilename, cfg); err != nil {
+		return fmt.Errorf("Failed to write config version to %v: %v", lm.configVersionFilename, err)
+	}
+
+	return nil
 }
 
 // SetPlusClients sets the necessary clients to work with NGINX Plus API. If not set, invoking the UpdateServersInPlus
@@ -253,18 +718,21 @@ func (lm *LocalManager) SetPlusClients(plusClient *client.NginxClient, plusConfi
 	lm.plusConfigVersionCheckClient = plusConfigVersionCheckClient
 }
 
-// UpdateServersInPlus updates NGINX Plus servers of the given upstream.
+// UpdateServersInPlus updates NGINX Plus servers of the given stream upstream.
 func (lm *LocalManager) UpdateServersInPlus(upstream string, servers []string, config ServerConfig) error {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
 	err := verifyConfigVersion(lm.plusConfigVersionCheckClient, lm.configVersion)
 	if err != nil {
 		return fmt.Errorf("error verifying config version: %v", err)
 	}
 
-	glog.V(3).Infof("API has the correct config version: %v.", lm.configVersion)
+	klog.V(3).InfoS("API has the correct config version", "configVersion", lm.configVersion)
 
-	var upsServers []client.UpstreamServer
+	var upsServers []client.StreamUpstreamServer
 	for _, s := range servers {
-		upsServers = append(upsServers, client.UpstreamServer{
+		upsServers = append(upsServers, client.StreamUpstreamServer{
 			Server:      s,
 			MaxFails:    &config.MaxFails,
 			MaxConns:    &config.MaxConns,
@@ -273,20 +741,20 @@ func (lm *LocalManager) UpdateServersInPlus(upstream string, servers []string, c
 		})
 	}
 
-	added, removed, updated, err := lm.plusClient.UpdateHTTPServers(upstream, upsServers)
+	added, removed, updated, err := lm.plusClient.UpdateStreamServers(upstream, upsServers)
 	if err != nil {
-		glog.V(3).Infof("Couldn't update servers of %v upstream: %v", upstream, err)
+		klog.V(3).InfoS("Couldn't update servers", "upstream", upstream, "err", err)
 		return fmt.Errorf("error updating servers of %v upstream: %v", upstream, err)
 	}
 
-	glog.V(3).Infof("Updated servers of %v; Added: %v, Removed: %v, Updated: %v", upstream, added, removed, updated)
+	klog.V(3).InfoS("Updated servers", "upstream", upstream, "added", added, "removed", removed, "updated", updated)
 
 	return nil
 }
 
 // CreateOpenTracingTracerConfig creates a json configuration file for the OpenTracing tracer with the content of the string.
 func (lm *LocalManager) CreateOpenTracingTracerConfig(content string) error {
-	glog.V(3).Infof("Writing OpenTracing tracer config file to %v", jsonFileForOpenTracingTracer)
+	klog.V(3).InfoS("Writing OpenTracing tracer config file", "filename", jsonFileForOpenTracingTracer)
 	err := createFileAndWrite(jsonFileForOpenTracingTracer, []byte(content))
 	if err != nil {
 		return fmt.Errorf("Failed to write config file: %v", err)
@@ -321,5 +789,8 @@ func verifyConfigVersion(httpClient *http.Client, configVersion int) error {
 
 // SetOpenTracing sets the value of OpenTracing for the Manager
 func (lm *LocalManager) SetOpenTracing(openTracing bool) {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
 	lm.OpenTracing = openTracing
 }
@@ -0,0 +1,412 @@
+package nginx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mohamed-gougam/kube-agent/internal/metrics/collectors"
+)
+
+var configVersionRegexp = regexp.MustCompile(`return 200 (\d+);`)
+
+// fileVersionTransport serves the config version found in the config version file, as NGINX would after a reload.
+type fileVersionTransport struct {
+	configVersionFilename string
+	// brokenConfigsPattern, if set, matches the config files that NGINX fails to reload if any contains "broken".
+	brokenConfigsPattern string
+}
+
+func (fvt fileVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if fvt.brokenConfigsPattern != "" {
+		filenames, _ := filepath.Glob(fvt.brokenConfigsPattern)
+		for _, filename := range filenames {
+			content, _ := ioutil.ReadFile(filename)
+			if bytes.Contains(content, []byte("broken")) {
+				return nil, fmt.Errorf("nginx failed to reload %v", filename)
+			}
+		}
+	}
+
+	content, err := ioutil.ReadFile(fvt.configVersionFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	version := configVersionRegexp.FindSubmatch(content)[1]
+
+	return &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBuffer(version)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+func createTestLocalManager(t *testing.T, binaryFilename string) *LocalManager {
+	tempDir, err := ioutil.TempDir("", "kube-agent-test")
+	if err != nil {
+		t.Fatalf("error creating a temp dir: %v", err)
+	}
+
+	for _, dir := range []string{"conf.d/tcp", "secrets"} {
+		err := os.MkdirAll(path.Join(tempDir, "nginx", dir), 0755)
+		if err != nil {
+			t.Fatalf("error creating %v: %v", dir, err)
+		}
+	}
+
+	lm := NewLocalManager(path.Join(tempDir, "nginx"), binaryFilename, collectors.NewManagerFakeCollector(), 0)
+	lm.shadowConfPath = path.Join(tempDir, "shadow")
+	lm.lastGoodConfPath = path.Join(tempDir, "last-good")
+	lm.verifyClient = &verifyClient{
+		client: &http.Client{
+			Transport: fileVersionTransport{configVersionFilename: lm.configVersionFilename},
+		},
+		maxRetries: 3,
+	}
+
+	return lm
+}
+
+// startFakeNginxMaster starts a process that ignores the reload and quit signals, as the NGINX master of lm.
+// Returns a function that stops the process.
+func startFakeNginxMaster(t *testing.T, lm *LocalManager) func() {
+	// the fake master reports when it ignores the signals, as a signal sent before kills it
+	cmd := exec.Command("sh", "-c", "trap '' HUP QUIT; echo ready; exec sleep 60")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("error creating the stdout pipe of the fake nginx master: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("error starting the fake nginx master: %v", err)
+	}
+	if _, err := bufio.NewReader(stdout).ReadString('\n'); err != nil {
+		t.Fatalf("error waiting for the fake nginx master: %v", err)
+	}
+
+	master := &nginxMaster{
+		process: cmd.Process,
+		exited:  make(chan struct{}),
+	}
+	go func() {
+		_ = cmd.Wait()
+		close(master.exited)
+	}()
+	lm.master = master
+
+	return func() {
+		_ = cmd.Process.Kill()
+		<-master.exited
+	}
+}
+
+func TestLocalManagerConcurrentApplyConfigs(t *testing.T) {
+	lm := createTestLocalManager(t, "true")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+	defer startFakeNginxMaster(t, lm)()
+
+	const workers = 8
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			changes := []ConfigChange{
+				{Name: "tcp/a", Content: []byte("a")},
+				{Name: "tcp/b", Content: []byte("b")},
+			}
+			if err := lm.ApplyConfigs(context.Background(), changes); err != nil {
+				t.Errorf("ApplyConfigs() returned unexpected error: %v", err)
+			}
+			if err := lm.Reload(context.Background()); err != nil {
+				t.Errorf("Reload() returned unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if lm.configVersion != 2*workers {
+		t.Errorf("config version is %v after %v reloads", lm.configVersion, 2*workers)
+	}
+
+	for _, name := range []string{"tcp/a", "tcp/b"} {
+		if _, err := os.Stat(lm.getFilenameForConfig(name)); err != nil {
+			t.Errorf("config %v wasn't written: %v", name, err)
+		}
+	}
+}
+
+func TestLocalManagerRollsBackOnReloadFailure(t *testing.T) {
+	// the config test always passes, but NGINX fails to reload any config containing "broken".
+	lm := createTestLocalManager(t, "true")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+	defer startFakeNginxMaster(t, lm)()
+
+	lm.verifyClient.client.Transport = fileVersionTransport{
+		configVersionFilename: lm.configVersionFilename,
+		brokenConfigsPattern:  path.Join(lm.confdPath, "tcp", "*.conf"),
+	}
+
+	if err := createFileAndWrite(lm.mainConfFilename, []byte("main")); err != nil {
+		t.Fatalf("error writing the main config: %v", err)
+	}
+
+	err := lm.ApplyConfigs(context.Background(), []ConfigChange{{Name: "tcp/a", Content: []byte("good")}})
+	if err != nil {
+		t.Fatalf("ApplyConfigs() returned unexpected error: %v", err)
+	}
+
+	err = lm.ApplyConfigs(context.Background(), []ConfigChange{
+		{Name: "tcp/a", Content: []byte("broken")},
+		{Name: "tcp/b", Content: []byte("new")},
+	})
+	if _, isRollbackErr := err.(*RollbackError); !isRollbackErr {
+		t.Fatalf("ApplyConfigs() returned %v, expected a *RollbackError", err)
+	}
+
+	content, err := ioutil.ReadFile(lm.getFilenameForConfig("tcp/a"))
+	if err != nil || string(content) != "good" {
+		t.Errorf("config tcp/a contains %q (%v) after the rollback, expected %q", content, err, "good")
+	}
+	if _, err := os.Stat(lm.getFilenameForConfig("tcp/b")); !os.IsNotExist(err) {
+		t.Errorf("config tcp/b exists after the rollback: %v", err)
+	}
+	if lm.configVersion != 3 {
+		t.Errorf("config version is %v after the rollback, expected 3", lm.configVersion)
+	}
+}
+
+func TestGetConfigNamesFromTestOutput(t *testing.T) {
+	output := `nginx: [emerg] unknown directive "foo" in /var/lib/nginx/shadow/conf.d/tcp/tcps_default_tea.conf:3
+nginx: configuration file /var/lib/nginx/shadow/nginx.conf test failed`
+
+	names := getConfigNamesFromTestOutput(output, "/var/lib/nginx/shadow/conf.d")
+	if len(names) != 1 || names[0] != "tcp/tcps_default_tea" {
+		t.Errorf("getConfigNamesFromTestOutput() returned %v, expected [tcp/tcps_default_tea]", names)
+	}
+
+	output = `nginx: [emerg] unknown directive "foo" in /var/lib/nginx/shadow/nginx.conf:12`
+
+	names = getConfigNamesFromTestOutput(output, "/var/lib/nginx/shadow/conf.d")
+	if len(names) != 0 {
+		t.Errorf("getConfigNamesFromTestOutput() returned %v for an error in the main config, expected none", names)
+	}
+}
+
+func TestLocalManagerSignalsPidFileMaster(t *testing.T) {
+	lm := createTestLocalManager(t, "true")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+	defer startFakeNginxMaster(t, lm)()
+
+	lm.pidFilename = path.Join(path.Dir(lm.shadowConfPath), "nginx.pid")
+
+	// a master that wasn't started by the LocalManager is found through the pid file
+	pid := lm.master.process.Pid
+	lm.master = nil
+
+	err := lm.signalNginx(syscall.SIGHUP)
+	if signalErr, ok := err.(*SignalError); !ok || signalErr.Reason != SignalFailureNoMaster {
+		t.Errorf("signalNginx() without a pid file returned %v, expected a *SignalError with the reason %v", err, SignalFailureNoMaster)
+	}
+
+	if err := ioutil.WriteFile(lm.pidFilename, []byte("nginx\n"), 0644); err != nil {
+		t.Fatalf("error writing the pid file: %v", err)
+	}
+	err = lm.signalNginx(syscall.SIGHUP)
+	if signalErr, ok := err.(*SignalError); !ok || signalErr.Reason != SignalFailureInvalidPidFile {
+		t.Errorf("signalNginx() with an invalid pid file returned %v, expected a *SignalError with the reason %v", err, SignalFailureInvalidPidFile)
+	}
+
+	if err := ioutil.WriteFile(lm.pidFilename, []byte(fmt.Sprintf("%d\n", pid)), 0644); err != nil {
+		t.Fatalf("error writing the pid file: %v", err)
+	}
+	if err := lm.signalNginx(syscall.SIGHUP); err != nil {
+		t.Errorf("signalNginx() with the pid file returned unexpected error: %v", err)
+	}
+}
+
+func TestRemoteManagerStartsWithPidFileMaster(t *testing.T) {
+	lm := createTestLocalManager(t, "true")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+	defer startFakeNginxMaster(t, lm)()
+
+	rm := &RemoteManager{LocalManager: lm}
+	rm.pidFilename = path.Join(path.Dir(lm.shadowConfPath), "nginx.pid")
+	if err := rm.UpdateConfigVersionFile(false); err != nil {
+		t.Fatalf("UpdateConfigVersionFile() returned unexpected error: %v", err)
+	}
+
+	// the master of the nginx container isn't started by the manager
+	if err := ioutil.WriteFile(rm.pidFilename, []byte(fmt.Sprintf("%d\n", lm.master.process.Pid)), 0644); err != nil {
+		t.Fatalf("error writing the pid file: %v", err)
+	}
+	rm.master = nil
+
+	done := make(chan error, 1)
+	rm.Start(done)
+
+	if err := rm.ApplyConfigs(context.Background(), []ConfigChange{{Name: "tcp/a", Content: []byte("a")}}); err != nil {
+		t.Errorf("ApplyConfigs() returned unexpected error: %v", err)
+	}
+
+	rm.Quit()
+	if err := <-done; err != nil {
+		t.Errorf("done received unexpected error after Quit: %v", err)
+	}
+}
+
+func TestLocalManagerRestoresConfigOnWriteFailure(t *testing.T) {
+	lm := createTestLocalManager(t, "true")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+
+	if err := createFileAndWrite(lm.mainConfFilename, []byte("main")); err != nil {
+		t.Fatalf("error writing the main config: %v", err)
+	}
+	if err := lm.CreateConfig("tcp/a", []byte("good")); err != nil {
+		t.Fatalf("CreateConfig() returned unexpected error: %v", err)
+	}
+	lm.saveLastGoodConf()
+
+	// the folder of tcp/missing/b doesn't exist, so it can't be written
+	err := lm.writeConfigs(nil, []ConfigChange{
+		{Name: "tcp/a", Content: []byte("new")},
+		{Name: "tcp/missing/b", Content: []byte("new")},
+	})
+	if _, isWriteErr := err.(*WriteError); !isWriteErr {
+		t.Fatalf("writeConfigs() returned %v, expected a *WriteError", err)
+	}
+
+	content, err := ioutil.ReadFile(lm.getFilenameForConfig("tcp/a"))
+	if err != nil || string(content) != "good" {
+		t.Errorf("config tcp/a contains %q (%v) after the failed write, expected %q", content, err, "good")
+	}
+
+	filenames, _ := filepath.Glob(path.Join(lm.confdPath, "tcp", "*"))
+	if len(filenames) != 1 {
+		t.Errorf("the tcp folder contains %v after the failed write, expected only the config tcp/a", filenames)
+	}
+}
+
+func TestLocalManagerCheckHealth(t *testing.T) {
+	lm := createTestLocalManager(t, "true")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+	stopMaster := startFakeNginxMaster(t, lm)
+
+	if err := lm.CheckHealth(); err == nil {
+		t.Errorf("CheckHealth() returned no error before the config version file was written")
+	}
+
+	if err := lm.UpdateConfigVersionFile(false); err != nil {
+		t.Fatalf("UpdateConfigVersionFile() returned unexpected error: %v", err)
+	}
+	if err := lm.CheckHealth(); err != nil {
+		t.Errorf("CheckHealth() returned unexpected error: %v", err)
+	}
+
+	// a reload or a restart in progress holds the lock
+	lm.lock.Lock()
+	checked := make(chan error, 1)
+	go func() {
+		checked <- lm.CheckHealth()
+	}()
+	select {
+	case err := <-checked:
+		if err != nil {
+			t.Errorf("CheckHealth() returned unexpected error during a reload: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("CheckHealth() waited for the reload in progress")
+	}
+	lm.lock.Unlock()
+
+	stopMaster()
+	err := lm.CheckHealth()
+	if signalErr, ok := err.(*SignalError); !ok || signalErr.Reason != SignalFailureMasterExited {
+		t.Errorf("CheckHealth() returned %v after the master exited, expected a SignalError with the reason %v", err, SignalFailureMasterExited)
+	}
+}
+
+func TestLocalManagerGetConfigVersions(t *testing.T) {
+	lm := createTestLocalManager(t, "true")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+
+	if _, _, err := lm.GetConfigVersions(); err == nil {
+		t.Errorf("GetConfigVersions() returned no error before the config version file was written")
+	}
+
+	lm.configVersion = 3
+	if err := lm.UpdateConfigVersionFile(false); err != nil {
+		t.Fatalf("UpdateConfigVersionFile() returned unexpected error: %v", err)
+	}
+	lm.configVersion = 4
+
+	written, running, err := lm.GetConfigVersions()
+	if err != nil {
+		t.Fatalf("GetConfigVersions() returned unexpected error: %v", err)
+	}
+	if written != 4 || running != 3 {
+		t.Errorf("GetConfigVersions() returned %v, %v, expected 4, 3", written, running)
+	}
+}
+
+func TestLocalManagerWriteConfigsWithoutReloadUpdatesLastGoodConf(t *testing.T) {
+	lm := createTestLocalManager(t, "true")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+
+	if err := createFileAndWrite(lm.mainConfFilename, []byte("main")); err != nil {
+		t.Fatalf("error writing the main config: %v", err)
+	}
+	if err := lm.CreateConfig("tcp/a", []byte("old")); err != nil {
+		t.Fatalf("CreateConfig() returned unexpected error: %v", err)
+	}
+	lm.saveLastGoodConf()
+
+	if err := lm.WriteConfigsWithoutReload([]ConfigChange{{Name: "tcp/a", Content: []byte("new")}}); err != nil {
+		t.Fatalf("WriteConfigsWithoutReload() returned unexpected error: %v", err)
+	}
+
+	if err := lm.restoreLastGoodConf(); err != nil {
+		t.Fatalf("restoreLastGoodConf() returned unexpected error: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(lm.getFilenameForConfig("tcp/a"))
+	if err != nil || string(content) != "new" {
+		t.Errorf("config tcp/a contains %q (%v) after restoring the last good config, expected %q", content, err, "new")
+	}
+}
+
+func TestLocalManagerReadConfig(t *testing.T) {
+	lm := createTestLocalManager(t, "true")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+
+	content := []byte("server {\n    listen 5000;\n}\n")
+	if err := lm.createConfig("tcp/tcps_default_tcps", content); err != nil {
+		t.Fatalf("createConfig() returned unexpected error: %v", err)
+	}
+
+	result, err := lm.ReadConfig("tcp/tcps_default_tcps")
+	if err != nil {
+		t.Errorf("ReadConfig() returned unexpected error: %v", err)
+	}
+	if string(result) != string(content) {
+		t.Errorf("ReadConfig() returned %q, expected %q", result, content)
+	}
+
+	if _, err := lm.ReadConfig("tcp/tcps_default_other"); err == nil {
+		t.Errorf("ReadConfig() returned no error for a config that doesn't exist")
+	}
+}
@@ -0,0 +1,89 @@
+package nginx
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/mohamed-gougam/kube-agent/internal/metrics/collectors"
+)
+
+// remoteStartRetryInterval is how long RemoteManager waits between the attempts to find the NGINX master process
+// of the sidecar on start.
+const remoteStartRetryInterval = time.Second
+
+// RemoteManager updates NGINX configuration, reloads and quits NGINX that runs in another container of the Pod.
+// The configuration is written to a volume shared with the NGINX container. NGINX is signaled through its pid file,
+// which requires the pid file to be on a shared volume and the containers to share the process namespace.
+// The configuration is tested with the NGINX binary of the agent's container, which must match the one of the NGINX
+// container. NGINX is started and restarted by its container, not by RemoteManager.
+type RemoteManager struct {
+	*LocalManager
+}
+
+// NewRemoteManager creates a RemoteManager.
+func NewRemoteManager(confPath string, binaryFilename string, mc collectors.ManagerCollector) *RemoteManager {
+	return &RemoteManager{
+		LocalManager: NewLocalManager(confPath, binaryFilename, mc, 0),
+	}
+}
+
+// Start waits for NGINX to run the current configuration. NGINX might have started before the configuration was
+// written, so it is reloaded until it runs the current config version. The lock is only held during an attempt,
+// so Quit can stop the waiting. done receives nil once Quit is called.
+func (rm *RemoteManager) Start(done chan error) {
+	klog.V(3).InfoS("Waiting for the nginx container")
+
+	for !rm.tryStart() {
+		select {
+		case <-rm.quitCh:
+			klog.V(3).InfoS("Stopped waiting for the nginx container")
+			done <- nil
+			return
+		case <-time.After(remoteStartRetryInterval):
+		}
+	}
+
+	go func() {
+		<-rm.quitCh
+		done <- nil
+	}()
+}
+
+// tryStart reloads NGINX and waits for it to run the current config version. Returns true and saves the
+// configuration as the last good one if NGINX runs the current config version.
+func (rm *RemoteManager) tryStart() bool {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+
+	err := rm.signalNginx(syscall.SIGHUP)
+	if err == nil {
+		err = rm.verifyClient.WaitForCorrectVersion(rm.configVersion)
+	}
+	if err != nil {
+		klog.InfoS("Waiting for nginx to run the config version", "configVersion", rm.configVersion, "err", err)
+		return false
+	}
+
+	rm.saveLastGoodConf()
+
+	return true
+}
+
+// CheckHealth checks that NGINX answers on the config version socket if its master process runs. While the master
+// process is gone, NGINX is restarted by its container with the backoff of Kubernetes and the agent is reported
+// healthy, as restarting the agent wouldn't restart NGINX.
+func (rm *RemoteManager) CheckHealth() error {
+	if err := signalPidFile(rm.pidFilename, 0); err != nil {
+		klog.V(3).InfoS("The nginx master process doesn't run, waiting for the nginx container to restart it", "err", err)
+		return nil
+	}
+
+	if _, err := rm.verifyClient.GetConfigVersionWithTimeout(configVersionCheckTimeout); err != nil {
+		return fmt.Errorf("nginx doesn't answer on the config version socket: %v", err)
+	}
+
+	return nil
+}
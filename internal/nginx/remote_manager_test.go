@@ -0,0 +1,78 @@
+package nginx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestRemoteManagerQuitStopsWaitingForNginx(t *testing.T) {
+	lm := createTestLocalManager(t, "")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+
+	// the nginx container never starts, so there is no master process to reload
+	rm := &RemoteManager{LocalManager: lm}
+
+	done := make(chan error, 1)
+	started := make(chan struct{})
+	go func() {
+		rm.Start(done)
+		close(started)
+	}()
+
+	quit := make(chan struct{})
+	go func() {
+		rm.Quit()
+		close(quit)
+	}()
+
+	select {
+	case <-quit:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for Quit() while waiting for the nginx container")
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start() sent the error %v after Quit(), expected nil", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for Start() to stop waiting for the nginx container")
+	}
+	<-started
+
+	if rm.hasLastGoodConf {
+		t.Errorf("Start() saved the last good config, expected nginx not to run the config version")
+	}
+}
+
+func TestRemoteManagerCheckHealthWhileNginxContainerRestarts(t *testing.T) {
+	lm := createTestLocalManager(t, "")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+	rm := &RemoteManager{LocalManager: lm}
+
+	// the pid file is gone while the nginx container restarts
+	rm.pidFilename = path.Join(path.Dir(lm.shadowConfPath), "nginx.pid")
+	if err := rm.CheckHealth(); err != nil {
+		t.Errorf("CheckHealth() returned unexpected error while the nginx container restarts: %v", err)
+	}
+
+	// the master process runs, but NGINX doesn't answer on the config version socket
+	if err := ioutil.WriteFile(rm.pidFilename, []byte(fmt.Sprintf("%v\n", os.Getpid())), 0644); err != nil {
+		t.Fatalf("error writing the pid file: %v", err)
+	}
+	if err := rm.CheckHealth(); err == nil {
+		t.Errorf("CheckHealth() returned no error while nginx doesn't answer on the config version socket")
+	}
+
+	if err := rm.UpdateConfigVersionFile(false); err != nil {
+		t.Fatalf("UpdateConfigVersionFile() returned unexpected error: %v", err)
+	}
+	if err := rm.CheckHealth(); err != nil {
+		t.Errorf("CheckHealth() returned unexpected error: %v", err)
+	}
+}
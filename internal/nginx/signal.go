@@ -0,0 +1,105 @@
+package nginx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"k8s.io/klog/v2"
+)
+
+// pidFilename is where the NGINX master process writes its pid, as set by the pid directive of the main config.
+const pidFilename = "/var/run/nginx.pid"
+
+// SignalFailureReason is the reason a signal couldn't be sent to the NGINX master process.
+type SignalFailureReason string
+
+const (
+	// SignalFailureNoMaster means that NGINX wasn't started by the LocalManager and the pid file doesn't exist.
+	SignalFailureNoMaster SignalFailureReason = "NoMasterProcess"
+	// SignalFailureInvalidPidFile means that the pid file couldn't be read or doesn't contain a pid.
+	SignalFailureInvalidPidFile SignalFailureReason = "InvalidPidFile"
+	// SignalFailureMasterExited means that the NGINX master process started by the LocalManager has exited.
+	SignalFailureMasterExited SignalFailureReason = "MasterExited"
+	// SignalFailureSend means that sending the signal failed, for example, because the process doesn't exist.
+	SignalFailureSend SignalFailureReason = "SendFailed"
+)
+
+// SignalError is returned when a signal couldn't be sent to the NGINX master process.
+type SignalError struct {
+	Signal syscall.Signal
+	// Pid is the pid of the master process, 0 if it is unknown.
+	Pid    int
+	Reason SignalFailureReason
+	Err    error
+}
+
+func (e *SignalError) Error() string {
+	if e.Pid == 0 {
+		return fmt.Sprintf("failed to send %v to the nginx master process: %v: %v", e.Signal, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("failed to send %v to the nginx master process (pid %v): %v: %v", e.Signal, e.Pid, e.Reason, e.Err)
+}
+
+// nginxMaster is an NGINX master process started by the LocalManager.
+type nginxMaster struct {
+	process *os.Process
+	// exited is closed once the process has exited.
+	exited chan struct{}
+}
+
+// signalNginx sends the signal to the NGINX master process: the process started by Start or, if NGINX wasn't started
+// by the LocalManager, the process of the pid file. Must be called with the lock held.
+func (lm *LocalManager) signalNginx(sig syscall.Signal) error {
+	return signalMaster(lm.master, lm.pidFilename, sig)
+}
+
+// signalMaster sends the signal to the master process, or to the process of the pid file if master is nil.
+func signalMaster(master *nginxMaster, pidFilename string, sig syscall.Signal) error {
+	if master == nil {
+		return signalPidFile(pidFilename, sig)
+	}
+
+	pid := master.process.Pid
+
+	select {
+	case <-master.exited:
+		return &SignalError{Signal: sig, Pid: pid, Reason: SignalFailureMasterExited, Err: fmt.Errorf("the process has exited")}
+	default:
+	}
+
+	klog.V(3).InfoS("Sending a signal to the nginx master process", "signal", sig, "pid", pid)
+
+	if err := master.process.Signal(sig); err != nil {
+		return &SignalError{Signal: sig, Pid: pid, Reason: SignalFailureSend, Err: err}
+	}
+
+	return nil
+}
+
+// signalPidFile sends the signal to the NGINX master process of the pid file.
+func signalPidFile(pidFilename string, sig syscall.Signal) error {
+	content, err := ioutil.ReadFile(pidFilename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &SignalError{Signal: sig, Reason: SignalFailureNoMaster, Err: err}
+		}
+		return &SignalError{Signal: sig, Reason: SignalFailureInvalidPidFile, Err: err}
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		return &SignalError{Signal: sig, Reason: SignalFailureInvalidPidFile, Err: fmt.Errorf("invalid pid %q in %v", content, pidFilename)}
+	}
+
+	klog.V(3).InfoS("Sending a signal to the nginx master process", "signal", sig, "pid", pid, "pidFilename", pidFilename)
+
+	if err := syscall.Kill(pid, sig); err != nil {
+		return &SignalError{Signal: sig, Pid: pid, Reason: SignalFailureSend, Err: err}
+	}
+
+	return nil
+}
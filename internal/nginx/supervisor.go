@@ -0,0 +1,162 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// defaultMinRestartBackoff is how long NGINX is restarted after it first exits unexpectedly.
+	// The backoff doubles with every restart in a row.
+	defaultMinRestartBackoff = time.Second
+
+	// defaultMaxRestartBackoff caps the backoff of the restarts of NGINX.
+	defaultMaxRestartBackoff = 30 * time.Second
+
+	// defaultStableRunDuration is how long NGINX must run after a restart for its next exit
+	// not to count as a restart in a row.
+	defaultStableRunDuration = time.Minute
+)
+
+// startNginx starts the NGINX master process and waits for it to run the current config version.
+// Returns a channel that receives the exit error of NGINX, and an error if NGINX doesn't run the current config version.
+// If NGINX fails to start, the channel receives the error right away. Must be called with the lock held.
+func (lm *LocalManager) startNginx() (<-chan error, error) {
+	exited := make(chan error, 1)
+
+	cmd := exec.Command(lm.binaryFilename)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		err = fmt.Errorf("failed to start nginx: %v", err)
+		exited <- err
+		return exited, err
+	}
+
+	master := &nginxMaster{
+		process: cmd.Process,
+		exited:  make(chan struct{}),
+	}
+	lm.stateLock.Lock()
+	lm.master = master
+	lm.stateLock.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+		close(master.exited)
+		exited <- err
+	}()
+
+	// if NGINX exits before it runs the config version, the error is received from exited
+	if err := lm.verifyClient.WaitForCorrectVersion(lm.configVersion); err != nil {
+		klog.ErrorS(err, "nginx doesn't run the config version after starting", "configVersion", lm.configVersion)
+		return exited, err
+	}
+
+	return exited, nil
+}
+
+// supervise restarts NGINX every time it exits unexpectedly, with an exponential backoff.
+// done receives the exit error of NGINX once it is quit, or once NGINX exited maxRestarts times in a row.
+func (lm *LocalManager) supervise(exited <-chan error, done chan error) {
+	restarts := 0
+	startTime := time.Now()
+
+	for {
+		err := <-exited
+
+		if lm.isQuitting() {
+			done <- err
+			return
+		}
+
+		if time.Since(startTime) >= lm.stableRunDuration {
+			restarts = 0
+		}
+
+		if restarts >= lm.maxRestarts {
+			klog.ErrorS(err, "nginx exited unexpectedly too many times in a row, giving up", "restarts", restarts)
+			done <- fmt.Errorf("nginx is crash looping: %v", err)
+			return
+		}
+
+		backoff := lm.getRestartBackoff(restarts)
+		klog.ErrorS(err, "nginx exited unexpectedly, restarting it", "reason", getExitReason(err), "restarts", restarts+1, "backoff", backoff)
+
+		lm.setRestarting(true)
+		exited = lm.restart(backoff)
+		lm.setRestarting(false)
+		restarts++
+		startTime = time.Now()
+		lm.metricsCollector.IncNginxRestarts()
+	}
+}
+
+// restart starts NGINX with the current configuration after the backoff. The lock is held from the start of the backoff
+// until NGINX runs, so that configuration changes are not reloaded while NGINX is down.
+func (lm *LocalManager) restart(backoff time.Duration) <-chan error {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	select {
+	case <-time.After(backoff):
+	case <-lm.quitCh:
+		exited := make(chan error, 1)
+		exited <- nil
+		return exited
+	}
+
+	exited, _ := lm.startNginx()
+	return exited
+}
+
+func (lm *LocalManager) setRestarting(restarting bool) {
+	lm.stateLock.Lock()
+	lm.restarting = restarting
+	lm.stateLock.Unlock()
+}
+
+// getExitReason returns why the NGINX master process exited: its exit status, or the signal that killed it.
+func getExitReason(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+
+	exitErr, isExitErr := err.(*exec.ExitError)
+	if !isExitErr {
+		return err.Error()
+	}
+
+	if status, isWaitStatus := exitErr.Sys().(syscall.WaitStatus); isWaitStatus && status.Signaled() {
+		return fmt.Sprintf("signal %v", status.Signal())
+	}
+
+	return fmt.Sprintf("exit status %v", exitErr.ExitCode())
+}
+
+func (lm *LocalManager) getRestartBackoff(restarts int) time.Duration {
+	backoff := lm.minRestartBackoff
+	for i := 0; i < restarts && backoff < lm.maxRestartBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > lm.maxRestartBackoff {
+		return lm.maxRestartBackoff
+	}
+
+	return backoff
+}
+
+func (lm *LocalManager) isQuitting() bool {
+	select {
+	case <-lm.quitCh:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,151 @@
+package nginx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalManagerRestartsNginxUntilCrashLoop(t *testing.T) {
+	lm := createTestLocalManager(t, "")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+
+	lm.maxRestarts = 2
+	lm.minRestartBackoff = time.Millisecond
+	lm.maxRestartBackoff = 2 * time.Millisecond
+	if err := lm.UpdateConfigVersionFile(false); err != nil {
+		t.Fatalf("UpdateConfigVersionFile() returned unexpected error: %v", err)
+	}
+
+	// the fake nginx binary records every start and exits right away.
+	startsFilename := path.Join(path.Dir(lm.shadowConfPath), "starts")
+	binaryFilename := path.Join(path.Dir(lm.shadowConfPath), "nginx.sh")
+	script := fmt.Sprintf("#!/bin/sh\necho start >> %v\nexit 1\n", startsFilename)
+	if err := ioutil.WriteFile(binaryFilename, []byte(script), 0755); err != nil {
+		t.Fatalf("error writing the fake nginx binary: %v", err)
+	}
+	lm.binaryFilename = binaryFilename
+
+	done := make(chan error, 1)
+	lm.Start(done)
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("nginx exited without an error after the crash loop")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for the supervisor to give up")
+	}
+
+	content, err := ioutil.ReadFile(startsFilename)
+	if err != nil {
+		t.Fatalf("error reading the starts of nginx: %v", err)
+	}
+	if starts := strings.Count(string(content), "start"); starts != 3 {
+		t.Errorf("nginx was started %v times, expected 3", starts)
+	}
+}
+
+func TestLocalManagerCheckHealthDuringRestartBackoff(t *testing.T) {
+	lm := createTestLocalManager(t, "false")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+
+	lm.maxRestarts = 1
+	lm.minRestartBackoff = time.Second
+	lm.maxRestartBackoff = time.Second
+	if err := lm.UpdateConfigVersionFile(false); err != nil {
+		t.Fatalf("UpdateConfigVersionFile() returned unexpected error: %v", err)
+	}
+
+	done := make(chan error, 1)
+	lm.Start(done)
+
+	// the supervisor waits for the backoff before it restarts nginx, which exited right away
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lm.stateLock.Lock()
+		restarting := lm.restarting
+		lm.stateLock.Unlock()
+		if restarting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the supervisor to restart nginx")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := lm.CheckHealth(); err != nil {
+		t.Errorf("CheckHealth() returned unexpected error during the restart backoff: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for the supervisor to give up")
+	}
+
+	if err := lm.CheckHealth(); err == nil {
+		t.Errorf("CheckHealth() returned no error after the supervisor gave up")
+	}
+}
+
+func TestGetRestartBackoff(t *testing.T) {
+	lm := &LocalManager{
+		minRestartBackoff: time.Second,
+		maxRestartBackoff: 5 * time.Second,
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for restarts, backoff := range expected {
+		if result := lm.getRestartBackoff(restarts); result != backoff {
+			t.Errorf("getRestartBackoff(%v) returned %v, expected %v", restarts, result, backoff)
+		}
+	}
+}
+
+func TestGetExitReason(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{
+			command:  "exit 3",
+			expected: "exit status 3",
+		},
+		{
+			command:  "kill -KILL $$",
+			expected: "signal killed",
+		},
+	}
+
+	for _, test := range tests {
+		err := exec.Command("sh", "-c", test.command).Run()
+		if result := getExitReason(err); result != test.expected {
+			t.Errorf("getExitReason() returned %q for %q, expected %q", result, test.command, test.expected)
+		}
+	}
+}
+
+func TestLocalManagerStartKeepsLastGoodConfWithoutConfigVersion(t *testing.T) {
+	lm := createTestLocalManager(t, "")
+	defer os.RemoveAll(path.Dir(lm.shadowConfPath))
+
+	// NGINX never writes the config version file, so it never runs the config version
+	lm.configVersion = 1
+	lm.binaryFilename = "true"
+
+	done := make(chan error, 1)
+	lm.Start(done)
+	lm.Quit()
+
+	if lm.hasLastGoodConf {
+		t.Errorf("Start() saved the last good config, expected NGINX not to run the config version")
+	}
+}
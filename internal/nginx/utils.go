@@ -1,78 +1,99 @@
 package nginx
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
-
-	"github.com/golang/glog"
+	"path/filepath"
 )
 
-func shellOut(cmd string) (err error) {
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
+// createFileAndWrite writes the file atomically, with the mode of the configuration files.
+func createFileAndWrite(name string, b []byte) error {
+	return createFileAndWriteAtomically(name, path.Dir(name), configFileMode, b)
+}
 
-	glog.V(3).Infof("executing %s", cmd)
+// createFileAndWriteAtomically writes the content to a temp file in tempPath and renames it to filename, so that
+// readers of filename never see a partially written file. tempPath must be on the same filesystem as filename.
+func createFileAndWriteAtomically(filename string, tempPath string, mode os.FileMode, content []byte) error {
+	file, err := ioutil.TempFile(tempPath, path.Base(filename))
+	if err != nil {
+		return fmt.Errorf("Couldn't create a temp file for the file %v: %v", filename, err)
+	}
 
-	command := exec.Command("sh", "-c", cmd)
-	command.Stdout = &stdout
-	command.Stderr = &stderr
+	// the temp file is removed if it couldn't be renamed
+	renamed := false
+	defer func() {
+		if !renamed {
+			os.Remove(file.Name())
+		}
+	}()
 
-	err = command.Start()
+	err = file.Chmod(mode)
 	if err != nil {
-		return fmt.Errorf("Failed to execute %v, err: %v", cmd, err)
+		file.Close()
+		return fmt.Errorf("Couldn't change the mode of the temp file %v: %v", file.Name(), err)
 	}
 
-	err = command.Wait()
+	_, err = file.Write(content)
 	if err != nil {
-		return fmt.Errorf("Command %v stdout: %q\nstderr: %q\nfinished with error: %v", cmd,
-			stdout.String(), stderr.String(), err)
+		file.Close()
+		return fmt.Errorf("Couldn't write to the temp file %v: %v", file.Name(), err)
 	}
-	return nil
-}
 
-func createFileAndWrite(name string, b []byte) error {
-	w, err := os.Create(name)
+	err = file.Close()
 	if err != nil {
-		return fmt.Errorf("Failed to open %v: %v", name, err)
+		return fmt.Errorf("Couldn't close the temp file %v: %v", file.Name(), err)
 	}
 
-	defer w.Close()
-
-	_, err = w.Write(b)
+	err = os.Rename(file.Name(), filename)
 	if err != nil {
-		return fmt.Errorf("Failed to write to %v: %v", name, err)
+		return fmt.Errorf("Couldn't rename the temp file %v to %v: %v", file.Name(), filename, err)
 	}
+	renamed = true
 
 	return nil
 }
 
-func createFileAndWriteAtomically(filename string, tempPath string, mode os.FileMode, content []byte) {
-	file, err := ioutil.TempFile(tempPath, path.Base(filename))
-	if err != nil {
-		glog.Fatalf("Couldn't create a temp file for the file %v: %v", filename, err)
-	}
-
-	err = file.Chmod(mode)
-	if err != nil {
-		glog.Fatalf("Couldn't change the mode of the temp file %v: %v", file.Name(), err)
-	}
+// copyDir copies the directory src to dst. Symlinks are copied as symlinks.
+func copyDir(src string, dst string) error {
+	return filepath.Walk(src, func(srcPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, srcPath)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, relPath)
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(srcPath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dstPath)
+		case info.IsDir():
+			return os.MkdirAll(dstPath, info.Mode().Perm())
+		default:
+			return copyFile(srcPath, dstPath)
+		}
+	})
+}
 
-	_, err = file.Write(content)
+// copyFile copies the file src to dst, keeping its mode. If dst already exists, it will be overridden.
+func copyFile(src string, dst string) error {
+	info, err := os.Stat(src)
 	if err != nil {
-		glog.Fatalf("Couldn't write to the temp file %v: %v", file.Name(), err)
+		return err
 	}
 
-	err = file.Close()
+	content, err := ioutil.ReadFile(src)
 	if err != nil {
-		glog.Fatalf("Couldn't close the temp file %v: %v", file.Name(), err)
+		return err
 	}
 
-	err = os.Rename(file.Name(), filename)
-	if err != nil {
-		glog.Fatalf("Couldn't rename the temp file %v to %v: %v", file.Name(), filename, err)
-	}
+	return ioutil.WriteFile(dst, content, info.Mode().Perm())
 }
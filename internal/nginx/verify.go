@@ -11,7 +11,7 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/golang/glog"
+	"k8s.io/klog/v2"
 )
 
 // verifyClient is a client for verifying the config version.
@@ -37,7 +37,24 @@ func newVerifyClient() *verifyClient {
 // GetConfigVersion get version number that we put in the nginx config to verify that we're using
 // the correct config.
 func (c *verifyClient) GetConfigVersion() (int, error) {
-	resp, err := c.client.Get("http://config-version/configVersion")
+	return c.getConfigVersion(context.Background())
+}
+
+// GetConfigVersionWithTimeout gets the config version like GetConfigVersion, but gives up after the timeout.
+func (c *verifyClient) GetConfigVersionWithTimeout(timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return c.getConfigVersion(ctx)
+}
+
+func (c *verifyClient) getConfigVersion(ctx context.Context) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://config-version/configVersion", nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return 0, fmt.Errorf("error getting client: %v", err)
 	}
@@ -67,11 +84,11 @@ func (c *verifyClient) WaitForCorrectVersion(expectedVersion int) error {
 
 		version, err := c.GetConfigVersion()
 		if err != nil {
-			glog.V(3).Infof("Unable to fetch version: %v", err)
+			klog.V(3).InfoS("Unable to fetch version", "err", err)
 			continue
 		}
 		if version == expectedVersion {
-			glog.V(3).Infof("success, version %v ensured. iterations: %v. took: %v", expectedVersion, i, time.Duration(i)*sleep)
+			klog.V(3).InfoS("Config version ensured", "configVersion", expectedVersion, "iterations", i, "took", time.Duration(i)*sleep)
 			return nil
 		}
 	}
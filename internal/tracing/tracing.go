@@ -0,0 +1,122 @@
+// Package tracing traces the reconciliation of the TCPServers with OpenTelemetry.
+// The spans are only recorded once Start is called. Until then, Tracer returns a tracer that records nothing.
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+
+	k8snginx_v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+const (
+	tracerName  = "github.com/mohamed-gougam/kube-agent"
+	serviceName = "kube-agent"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// The attributes of the spans.
+const (
+	TCPServerKey                = label.Key("tcpserver")
+	TCPServerNamespaceKey       = label.Key("tcpserver.namespace")
+	TCPServerNameKey            = label.Key("tcpserver.name")
+	TCPServerResourceVersionKey = label.Key("tcpserver.resource_version")
+	TCPServerListenPortKey      = label.Key("tcpserver.listen_port")
+	TCPServerServiceKey         = label.Key("tcpserver.service")
+	TCPServerServicePortKey     = label.Key("tcpserver.service_port")
+	TCPServerUpstreamsKey       = label.Key("tcpserver.upstream_servers")
+	TCPServersKey               = label.Key("tcpservers")
+	// SyncResultKey is what a sync of a TCPServer did: applied, deleted or invalid.
+	SyncResultKey     = label.Key("sync.result")
+	EndpointsErrorKey = label.Key("endpoints.error")
+	PodsKey           = label.Key("pods")
+	ConfigVersionKey  = label.Key("nginx.config_version")
+	ConfigChangesKey  = label.Key("nginx.config_changes")
+)
+
+// errorHandler logs the errors of OpenTelemetry, such as the collector being unreachable.
+type errorHandler struct{}
+
+func (errorHandler) Handle(err error) {
+	if err == nil {
+		return
+	}
+
+	klog.ErrorS(err, "Error exporting the spans")
+}
+
+// Start exports the spans over OTLP, with gRPC, to the collector at endpoint, in batches.
+// If insecure is true, the connection to the collector doesn't use TLS.
+// Returns a function that exports the remaining spans and stops exporting.
+func Start(endpoint string, insecure bool) (func(), error) {
+	opts := []otlp.ExporterOption{otlp.WithAddress(endpoint)}
+	if insecure {
+		opts = append(opts, otlp.WithInsecure())
+	}
+
+	// the exporter connects in the background and keeps reconnecting, so the agent starts without the collector
+	exporter, err := otlp.NewExporter(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(serviceName))),
+	)
+
+	otel.SetErrorHandler(errorHandler{})
+	otel.SetTracerProvider(provider)
+
+	shutdown := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := provider.Shutdown(ctx); err != nil {
+			klog.ErrorS(err, "Error exporting the remaining spans")
+		}
+		if err := exporter.Shutdown(ctx); err != nil {
+			klog.ErrorS(err, "Error stopping the exporter of the spans")
+		}
+	}
+
+	return shutdown, nil
+}
+
+// Tracer returns the tracer of the agent.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// TCPServerAttributes returns the attributes of the spans about the TCPServer.
+func TCPServerAttributes(tcps *k8snginx_v1.TCPServer) []label.KeyValue {
+	return []label.KeyValue{
+		TCPServerNamespaceKey.String(tcps.Namespace),
+		TCPServerNameKey.String(tcps.Name),
+		TCPServerResourceVersionKey.String(tcps.ResourceVersion),
+		TCPServerListenPortKey.Int(tcps.Spec.ListenPort),
+		TCPServerServiceKey.String(tcps.Spec.ServiceName),
+		TCPServerServicePortKey.Int(tcps.Spec.ServicePort),
+	}
+}
+
+// SetError marks the span as failed with err. Does nothing if err is nil.
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -20,6 +20,20 @@ type TCPServerSpec struct {
 	ListenPort  int    `json:"listenPort"`
 	ServiceName string `json:"serviceName"`
 	ServicePort int    `json:"servicePort"`
+	// ServerSnippets are NGINX directives added to the server block. Allowed only if snippets are enabled in the agent.
+	ServerSnippets string `json:"serverSnippets,omitempty"`
+	// UpstreamSnippets are NGINX directives added to the upstream block. Allowed only if snippets are enabled in the agent.
+	UpstreamSnippets string `json:"upstreamSnippets,omitempty"`
+	// AccessLog overrides the stream access log of the agent for the TCPServer.
+	AccessLog *AccessLog `json:"accessLog,omitempty"`
+}
+
+// AccessLog defines the access log of a TCPServer.
+type AccessLog struct {
+	// Disable disables the access log of the TCPServer.
+	Disable bool `json:"disable,omitempty"`
+	// Path is the destination of the access log: a syslog: destination, /dev/stdout or a file in /var/log/nginx/.
+	Path string `json:"path,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
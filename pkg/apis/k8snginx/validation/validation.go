@@ -1,27 +1,155 @@
 package validation
 
 import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
 	v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
 	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
+// NginxCapabilities describes the NGINX binary that runs the TCPServers.
+type NginxCapabilities interface {
+	IsPlus() bool
+	HasModule(name string) bool
+}
+
 // ValidateTCPServer returns error if tcpServer is not a valid TCPServer.
-func ValidateTCPServer(tcpServer *v1.TCPServer) error {
-	errs := validateTCPServerSpec(&tcpServer.Spec, field.NewPath("spec"))
+// Snippets are only valid if enableSnippets is true.
+// The features of tcpServer must be supported by the NGINX binary described by capabilities.
+func ValidateTCPServer(tcpServer *v1.TCPServer, enableSnippets bool, capabilities NginxCapabilities) error {
+	errs := validateTCPServerSpec(&tcpServer.Spec, field.NewPath("spec"), enableSnippets, capabilities)
 	return errs.ToAggregate()
 }
 
-func validateTCPServerSpec(tcpServerSpec *v1.TCPServerSpec, fieldPath *field.Path) field.ErrorList {
+func validateTCPServerSpec(tcpServerSpec *v1.TCPServerSpec, fieldPath *field.Path, enableSnippets bool, capabilities NginxCapabilities) field.ErrorList {
 	errs := field.ErrorList{}
 
+	errs = append(errs, validateModules(capabilities, fieldPath, "stream_proxy", "stream_upstream")...)
 	errs = append(errs, validatePort(tcpServerSpec.ListenPort, fieldPath.Child("listenPort"))...)
 	errs = append(errs, validateServiceName(tcpServerSpec.ServiceName, fieldPath.Child("serviceName"))...)
 	errs = append(errs, validatePort(tcpServerSpec.ServicePort, fieldPath.Child("servicePort"))...)
+	errs = append(errs, validateSnippets(tcpServerSpec.ServerSnippets, fieldPath.Child("serverSnippets"), enableSnippets, capabilities)...)
+	errs = append(errs, validateSnippets(tcpServerSpec.UpstreamSnippets, fieldPath.Child("upstreamSnippets"), enableSnippets, capabilities)...)
+	errs = append(errs, validateAccessLog(tcpServerSpec.AccessLog, fieldPath.Child("accessLog"))...)
+	if tcpServerSpec.AccessLog != nil && !tcpServerSpec.AccessLog.Disable {
+		errs = append(errs, validateModules(capabilities, fieldPath.Child("accessLog"), "stream_log")...)
+	}
+
+	return errs
+}
+
+// validateModules checks that the modules are compiled into NGINX.
+func validateModules(capabilities NginxCapabilities, fieldPath *field.Path, modules ...string) field.ErrorList {
+	errs := field.ErrorList{}
+
+	for _, module := range modules {
+		if !capabilities.HasModule(module) {
+			errs = append(errs, field.Forbidden(fieldPath, fmt.Sprintf("requires ngx_%s_module, which NGINX is built without", module)))
+		}
+	}
+
+	return errs
+}
+
+// snippetDirectiveModules maps the directives that can be used in snippets to the modules that provide them.
+// Only the modules that are not always built with the stream module are listed.
+var snippetDirectiveModules = map[string]string{
+	"geoip_city":          "stream_geoip",
+	"geoip_country":       "stream_geoip",
+	"geoip_org":           "stream_geoip",
+	"preread_buffer_size": "stream_ssl_preread",
+	"preread_timeout":     "stream_ssl_preread",
+	"proxy_ssl":           "stream_ssl",
+	"set_real_ip_from":    "stream_realip",
+	"ssl_certificate":     "stream_ssl",
+	"ssl_certificate_key": "stream_ssl",
+	"ssl_preread":         "stream_ssl_preread",
+}
+
+// plusSnippetDirectives are the directives that can be used in snippets only with NGINX Plus.
+var plusSnippetDirectives = map[string]bool{
+	"health_check":  true,
+	"match":         true,
+	"ntlm":          true,
+	"queue":         true,
+	"state":         true,
+	"zone_sync":     true,
+	"zone_sync_ssl": true,
+}
+
+// validateSnippetDirectives checks that the directives of the snippets are supported by NGINX.
+// Only the first word of each statement is checked, as the snippets are not parsed.
+func validateSnippetDirectives(snippets string, fieldPath *field.Path, capabilities NginxCapabilities) field.ErrorList {
+	errs := field.ErrorList{}
+	checked := make(map[string]bool)
+
+	for _, statement := range strings.FieldsFunc(snippets, func(r rune) bool { return r == ';' || r == '{' || r == '}' || r == '\n' }) {
+		words := strings.Fields(statement)
+		if len(words) == 0 || checked[words[0]] {
+			continue
+		}
+		directive := words[0]
+		checked[directive] = true
+
+		if plusSnippetDirectives[directive] && !capabilities.IsPlus() {
+			errs = append(errs, field.Forbidden(fieldPath, fmt.Sprintf("the directive %s is only available in NGINX Plus", directive)))
+		}
+		if module, exists := snippetDirectiveModules[directive]; exists && !capabilities.HasModule(module) {
+			errs = append(errs, field.Forbidden(fieldPath, fmt.Sprintf("the directive %s requires ngx_%s_module, which NGINX is built without", directive, module)))
+		}
+	}
 
 	return errs
 }
 
+// accessLogPathRegexp matches the paths that can't break out of the access_log directive.
+var accessLogPathRegexp = regexp.MustCompile(`^[^\s;{}'"\\$]+$`)
+
+const accessLogDirectory = "/var/log/nginx/"
+
+func validateAccessLog(accessLog *v1.AccessLog, fieldPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if accessLog == nil || accessLog.Path == "" {
+		return errs
+	}
+
+	logPath := accessLog.Path
+	pathField := fieldPath.Child("path")
+
+	if !accessLogPathRegexp.MatchString(logPath) {
+		return append(errs, field.Invalid(pathField, logPath, "must not contain whitespace or any of the characters ;{}'\"\\$"))
+	}
+
+	if strings.HasPrefix(logPath, "syslog:") || logPath == "/dev/stdout" {
+		return errs
+	}
+
+	if !strings.HasPrefix(logPath, accessLogDirectory) || path.Clean(logPath) != logPath || len(logPath) == len(accessLogDirectory) {
+		errs = append(errs, field.Invalid(pathField, logPath, "must be a syslog: destination, /dev/stdout or a file in "+accessLogDirectory))
+	}
+
+	return errs
+}
+
+func validateSnippets(snippets string, fieldPath *field.Path, enableSnippets bool, capabilities NginxCapabilities) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if snippets == "" {
+		return errs
+	}
+
+	if !enableSnippets {
+		return append(errs, field.Forbidden(fieldPath, "snippets are not enabled"))
+	}
+
+	return append(errs, validateSnippetDirectives(snippets, fieldPath, capabilities)...)
+}
+
 func validatePort(port int, fieldPath *field.Path) field.ErrorList {
 	errs := field.ErrorList{}
 
@@ -0,0 +1,168 @@
+package validation
+
+import (
+	"testing"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	v1 "github.com/mohamed-gougam/kube-agent/pkg/apis/k8snginx/v1"
+)
+
+type fakeCapabilities struct {
+	plus    bool
+	modules map[string]bool
+}
+
+func (c *fakeCapabilities) IsPlus() bool {
+	return c.plus
+}
+
+func (c *fakeCapabilities) HasModule(name string) bool {
+	return c.modules[name]
+}
+
+var ossCapabilities = &fakeCapabilities{
+	modules: map[string]bool{"stream": true, "stream_proxy": true, "stream_upstream": true, "stream_log": true},
+}
+
+func TestValidateTCPServerSnippets(t *testing.T) {
+	tests := []struct {
+		spec           v1.TCPServerSpec
+		enableSnippets bool
+		valid          bool
+		msg            string
+	}{
+		{
+			spec:           v1.TCPServerSpec{ListenPort: 8000, ServiceName: "svc", ServicePort: 80},
+			enableSnippets: false,
+			valid:          true,
+			msg:            "no snippets with snippets disabled",
+		},
+		{
+			spec:           v1.TCPServerSpec{ListenPort: 8000, ServiceName: "svc", ServicePort: 80, ServerSnippets: "proxy_timeout 1m;"},
+			enableSnippets: false,
+			valid:          false,
+			msg:            "server snippets with snippets disabled",
+		},
+		{
+			spec:           v1.TCPServerSpec{ListenPort: 8000, ServiceName: "svc", ServicePort: 80, UpstreamSnippets: "least_conn;"},
+			enableSnippets: false,
+			valid:          false,
+			msg:            "upstream snippets with snippets disabled",
+		},
+		{
+			spec:           v1.TCPServerSpec{ListenPort: 8000, ServiceName: "svc", ServicePort: 80, ServerSnippets: "proxy_timeout 1m;", UpstreamSnippets: "least_conn;"},
+			enableSnippets: true,
+			valid:          true,
+			msg:            "snippets with snippets enabled",
+		},
+	}
+
+	for _, test := range tests {
+		tcpServer := &v1.TCPServer{
+			ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "tcps"},
+			Spec:       test.spec,
+		}
+
+		err := ValidateTCPServer(tcpServer, test.enableSnippets, ossCapabilities)
+		if test.valid && err != nil {
+			t.Errorf("ValidateTCPServer() returned unexpected error for the case of %s: %v", test.msg, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("ValidateTCPServer() returned no error for the case of %s", test.msg)
+		}
+	}
+}
+
+func TestValidateTCPServerCapabilities(t *testing.T) {
+	tests := []struct {
+		spec         v1.TCPServerSpec
+		capabilities *fakeCapabilities
+		valid        bool
+		msg          string
+	}{
+		{
+			spec:         v1.TCPServerSpec{ListenPort: 8000, ServiceName: "svc", ServicePort: 80},
+			capabilities: &fakeCapabilities{},
+			valid:        false,
+			msg:          "NGINX without the stream module",
+		},
+		{
+			spec:         v1.TCPServerSpec{ListenPort: 8000, ServiceName: "svc", ServicePort: 80, ServerSnippets: "ssl_preread on;"},
+			capabilities: ossCapabilities,
+			valid:        false,
+			msg:          "snippets with a directive of a missing module",
+		},
+		{
+			spec:         v1.TCPServerSpec{ListenPort: 8000, ServiceName: "svc", ServicePort: 80, ServerSnippets: "ssl_preread on;"},
+			capabilities: &fakeCapabilities{modules: map[string]bool{"stream_proxy": true, "stream_upstream": true, "stream_ssl_preread": true}},
+			valid:        true,
+			msg:          "snippets with a directive of a compiled module",
+		},
+		{
+			spec:         v1.TCPServerSpec{ListenPort: 8000, ServiceName: "svc", ServicePort: 80, ServerSnippets: "health_check interval=5s;"},
+			capabilities: ossCapabilities,
+			valid:        false,
+			msg:          "snippets with a Plus directive in NGINX OSS",
+		},
+		{
+			spec:         v1.TCPServerSpec{ListenPort: 8000, ServiceName: "svc", ServicePort: 80, ServerSnippets: "health_check interval=5s;"},
+			capabilities: &fakeCapabilities{plus: true, modules: ossCapabilities.modules},
+			valid:        true,
+			msg:          "snippets with a Plus directive in NGINX Plus",
+		},
+		{
+			spec:         v1.TCPServerSpec{ListenPort: 8000, ServiceName: "svc", ServicePort: 80, AccessLog: &v1.AccessLog{Path: "/dev/stdout"}},
+			capabilities: &fakeCapabilities{modules: map[string]bool{"stream_proxy": true, "stream_upstream": true}},
+			valid:        false,
+			msg:          "access log with NGINX without the stream log module",
+		},
+	}
+
+	for _, test := range tests {
+		tcpServer := &v1.TCPServer{
+			ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "tcps"},
+			Spec:       test.spec,
+		}
+
+		err := ValidateTCPServer(tcpServer, true, test.capabilities)
+		if test.valid && err != nil {
+			t.Errorf("ValidateTCPServer() returned unexpected error for the case of %s: %v", test.msg, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("ValidateTCPServer() returned no error for the case of %s", test.msg)
+		}
+	}
+}
+
+func TestValidateAccessLog(t *testing.T) {
+	validPaths := []string{
+		"",
+		"/dev/stdout",
+		"syslog:server=10.0.0.1:514,tag=nginx",
+		"/var/log/nginx/tcpserver.log",
+	}
+	for _, path := range validPaths {
+		errs := validateAccessLog(&v1.AccessLog{Path: path}, field.NewPath("accessLog"))
+		if len(errs) > 0 {
+			t.Errorf("validateAccessLog() returned errors for the valid path %q: %v", path, errs)
+		}
+	}
+
+	invalidPaths := []string{
+		"/etc/nginx/nginx.conf",
+		"/var/log/nginx/",
+		"/var/log/nginx/../../../etc/nginx/nginx.conf",
+		"/dev/stdout; include /etc/passwd",
+		"syslog:server=10.0.0.1 main",
+		"/var/log/nginx/$remote_addr",
+		"off",
+	}
+	for _, path := range invalidPaths {
+		errs := validateAccessLog(&v1.AccessLog{Path: path}, field.NewPath("accessLog"))
+		if len(errs) == 0 {
+			t.Errorf("validateAccessLog() returned no errors for the invalid path %q", path)
+		}
+	}
+}